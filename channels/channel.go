@@ -0,0 +1,64 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+// a channel is one way of reaching a recipient: sms today, email, push or webhooks later.
+// the pipeline (handler -> repo -> dao -> kafka -> consumer) is shared by all of them, a channel
+// only supplies the parts that differ: validating a request, rendering its message and delivering it.
+
+type Channel interface {
+	Name() string        // value of the channel field on requests and rows, e.g. "sms"
+	PayloadType() string // type of the kafka payload the consumer routes on, e.g. "SMS_REQUEST"
+	Provider() string    // provider deliveries go through, recorded on the request
+	Validate(req *models.SendSms) error
+	Render(template *models.SMSTemplate, params map[string]string) (string, error)
+	// Deliver hands the message to the provider and returns the id the provider assigned to it.
+	// Failures are returned as *gateway.GatewayError so the caller can decide whether to retry.
+	Deliver(ctx context.Context, req *models.SMSRequest) (string, error)
+}
+
+// DEFAULT_CHANNEL is used for requests without a channel, including rows written before channels existed.
+const DEFAULT_CHANNEL = SMS_CHANNEL_NAME
+
+var ErrUnknownChannel = errors.New("unknown channel")
+
+var (
+	registryMu            sync.RWMutex
+	channelsByName        = map[string]Channel{}
+	channelsByPayloadType = map[string]Channel{}
+)
+
+// RegisterChannel makes a channel available to the api and the consumer, it is called once per channel at startup.
+func RegisterChannel(channel Channel) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	channelsByName[channel.Name()] = channel
+	channelsByPayloadType[channel.PayloadType()] = channel
+}
+
+func GetChannel(name string) (Channel, error) {
+	if name == "" {
+		name = DEFAULT_CHANNEL
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	channel, ok := channelsByName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownChannel, name)
+	}
+	return channel, nil
+}
+
+func GetChannelByPayloadType(payloadType string) (Channel, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	channel, ok := channelsByPayloadType[payloadType]
+	return channel, ok
+}
@@ -0,0 +1,51 @@
+package channels
+
+import (
+	"context"
+	"errors"
+
+	"github.com/padam-meesho/NotificationService/gateway"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+const (
+	SMS_CHANNEL_NAME = "sms"
+	SMS_PAYLOAD_TYPE = "SMS_REQUEST"
+)
+
+// SmsChannelImpl delivers text messages through the configured sms gateway.
+type SmsChannelImpl struct {
+	smsGateway gateway.SMSGateway
+}
+
+func NewSmsChannel(smsGateway gateway.SMSGateway) *SmsChannelImpl {
+	return &SmsChannelImpl{smsGateway: smsGateway}
+}
+
+func (s *SmsChannelImpl) Name() string {
+	return SMS_CHANNEL_NAME
+}
+
+func (s *SmsChannelImpl) PayloadType() string {
+	return SMS_PAYLOAD_TYPE
+}
+
+func (s *SmsChannelImpl) Provider() string {
+	return s.smsGateway.Name()
+}
+
+func (s *SmsChannelImpl) Validate(req *models.SendSms) error {
+	if req.PhoneNumber == "" {
+		return errors.New("phone_number is required")
+	}
+	return nil
+}
+
+func (s *SmsChannelImpl) Render(template *models.SMSTemplate, params map[string]string) (string, error) {
+	return utils.RenderTemplate(template.Body, params)
+}
+
+func (s *SmsChannelImpl) Deliver(ctx context.Context, req *models.SMSRequest) (string, error) {
+	return s.smsGateway.Send(ctx, req)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"os"
+
 	"github.com/padam-meesho/NotificationService/config"
 	"github.com/padam-meesho/NotificationService/internal/app"
+	"github.com/padam-meesho/NotificationService/internal/lifecycle"
 	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/routes"
+	"github.com/padam-meesho/NotificationService/internal/utils"
 )
 
 type appConfig struct {
@@ -23,6 +27,14 @@ func main() {
 	config.LoadAppConfig(&appConfigInstance.Configs)
 	app.NewApp(appConfigInstance.Configs)
 	routes.SetUpRoutes()
+
+	// starts everything registered above and blocks until SIGINT/SIGTERM, then shuts down in reverse order.
+	err := lifecycle.GetLifecycle().Run()
+	if err != nil {
+		logger := utils.ComponentLogger("main")
+		logger.Error().Err(err).Msg("Shutdown completed with errors")
+		os.Exit(1)
+	}
 }
 
 // additionally for all the different configs or the services,
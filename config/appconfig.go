@@ -9,6 +9,10 @@ import (
 	"github.com/spf13/viper"
 )
 
+var (
+	appConfigInstance *models.AppConfig
+)
+
 func LoadAppConfig(cfg *models.AppConfig) (*models.AppConfig, error) {
 	v := viper.New()
 
@@ -36,5 +40,11 @@ func LoadAppConfig(cfg *models.AppConfig) (*models.AppConfig, error) {
 		return nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
 
+	appConfigInstance = cfg
 	return cfg, nil
 }
+
+// GetAppConfig returns the config loaded by LoadAppConfig.
+func GetAppConfig() *models.AppConfig {
+	return appConfigInstance
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/padam-meesho/NotificationService/internal/models"
@@ -11,8 +13,14 @@ import (
 type KafkaClientImpl struct {
 	KafkaProducer *kafka.Producer
 	KafkaConsumer *kafka.Consumer
+	// one consumer per retry tier, keyed by the retry topic, so a tier waiting
+	// out its delay never blocks the main topic or the other tiers.
+	KafkaRetryConsumers map[string]*kafka.Consumer
 }
 
+// DEFAULT_KAFKA_DELIVERY_TIMEOUT is how long a message may wait for the broker's acknowledgement when kafka.producer.deliveryTimeout is not set.
+const DEFAULT_KAFKA_DELIVERY_TIMEOUT = 10 * time.Second
+
 var (
 	kafkaOnce     sync.Once
 	kafkaInstance *KafkaClientImpl
@@ -28,14 +36,25 @@ func NewKafkaClient(appConfig *models.AppConfig) *KafkaClientImpl {
 			Msg("Initializing Kafka client")
 
 		kafkaInstance = &KafkaClientImpl{
-			KafkaProducer: InitKafkaProducer(appConfig),
-			KafkaConsumer: InitKafkaConsumer(appConfig),
+			KafkaProducer:       InitKafkaProducer(appConfig),
+			KafkaConsumer:       InitKafkaConsumer(appConfig, appConfig.Kafka.GroupId),
+			KafkaRetryConsumers: make(map[string]*kafka.Consumer),
 		}
 
 		if kafkaInstance.KafkaProducer == nil || kafkaInstance.KafkaConsumer == nil {
 			logger.Fatal().Msg("Failed to initialize Kafka producer or consumer")
 		}
 
+		for i, tier := range appConfig.Kafka.Retry.Tiers {
+			retryConsumer := InitKafkaConsumer(appConfig, RetryGroupId(appConfig.Kafka.GroupId, i))
+			if retryConsumer == nil {
+				logger.Fatal().
+					Str("topic", tier.Topic).
+					Msg("Failed to initialize Kafka retry consumer")
+			}
+			kafkaInstance.KafkaRetryConsumers[tier.Topic] = retryConsumer
+		}
+
 		logger.Info().Msg("Successfully initialized Kafka client")
 	})
 	return kafkaInstance
@@ -48,8 +67,19 @@ func GetKafkaClient() *KafkaClientImpl {
 func InitKafkaProducer(appConfig *models.AppConfig) *kafka.Producer {
 	logger := utils.ComponentLogger("kafka")
 
+	// the producer gives up on a message when the delivery timeout runs out, like a sync produce call does,
+	// so a message reported as failed is not stored by the broker later on. acks=all makes the
+	// acknowledgement mean every in-sync replica has the message, and idempotence keeps the messages
+	// of a key in the order they were produced when the producer has to resend some of them.
+	deliveryTimeout := appConfig.Kafka.Producer.DeliveryTimeout
+	if deliveryTimeout <= 0 {
+		deliveryTimeout = DEFAULT_KAFKA_DELIVERY_TIMEOUT
+	}
 	p, err := kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": appConfig.Kafka.BootStrapServers,
+		"bootstrap.servers":  appConfig.Kafka.BootStrapServers,
+		"acks":               "all",
+		"enable.idempotence": true,
+		"message.timeout.ms": int(deliveryTimeout.Milliseconds()),
 	})
 	if err != nil {
 		logger.Error().
@@ -65,26 +95,35 @@ func InitKafkaProducer(appConfig *models.AppConfig) *kafka.Producer {
 	return p
 }
 
-func InitKafkaConsumer(appConfig *models.AppConfig) *kafka.Consumer {
+// RetryGroupId is the consumer group of the retry tier at index tier. Every tier has its own group, apart from
+// the main topic's, so a rebalance of one tier's consumers never revokes the partitions of another.
+func RetryGroupId(groupId string, tier int) string {
+	return fmt.Sprintf("%s-retry-%d", groupId, tier+1)
+}
+
+func InitKafkaConsumer(appConfig *models.AppConfig, groupId string) *kafka.Consumer {
 	logger := utils.ComponentLogger("kafka")
 
+	// offsets are committed by the consumer loop once a message and every message before it on the partition are
+	// done, never automatically, so a message in hand when the service stops is consumed again instead of being skipped.
 	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": appConfig.Kafka.BootStrapServers,
-		"group.id":          appConfig.Kafka.GroupId,
-		"auto.offset.reset": appConfig.Kafka.AutoOffsetReset,
+		"bootstrap.servers":  appConfig.Kafka.BootStrapServers,
+		"group.id":           groupId,
+		"auto.offset.reset":  appConfig.Kafka.AutoOffsetReset,
+		"enable.auto.commit": false,
 	})
 	if err != nil {
 		logger.Error().
 			Err(err).
 			Str("bootstrap_servers", appConfig.Kafka.BootStrapServers).
-			Str("group_id", appConfig.Kafka.GroupId).
+			Str("group_id", groupId).
 			Msg("Failed to create Kafka consumer")
 		return nil
 	}
 
 	logger.Info().
 		Str("bootstrap_servers", appConfig.Kafka.BootStrapServers).
-		Str("group_id", appConfig.Kafka.GroupId).
+		Str("group_id", groupId).
 		Msg("Successfully created Kafka consumer")
 	return c
 }
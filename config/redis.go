@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -37,3 +38,15 @@ func NewRedisCache(config *models.AppConfig) *RedisCacheClient {
 func GetRedisClient() *RedisCacheClient {
 	return redisCacheClient
 }
+
+// Close closes the client's connection pool.
+func (r *RedisCacheClient) Close() error {
+	logger := utils.ComponentLogger("redis")
+	err := r.RedisClient.Close()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to close Redis client")
+		return err
+	}
+	logger.Info().Msg("Closed Redis client")
+	return nil
+}
@@ -65,3 +65,10 @@ func InitScyllaSession(appConfig *models.AppConfig) *ScyllaSession {
 func GetScyllaSession() *ScyllaSession {
 	return scyllaDBSession
 }
+
+// Close closes the session's connections, queries running on it fail from then on.
+func (s *ScyllaSession) Close() {
+	logger := utils.ComponentLogger("scylla")
+	s.ScyllaSession.Close()
+	logger.Info().Msg("Closed ScyllaDB session")
+}
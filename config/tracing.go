@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"sync"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// traces follow the W3C trace context: an incoming traceparent header is continued, otherwise a new trace
+// is started, and the trace travels on to the consumer in the kafka message headers. The tracer provider
+// always runs so every request and message gets a trace id for its logs; spans are only exported over
+// OTLP when tracing is enabled.
+
+type TracingClient struct {
+	TracerProvider *sdktrace.TracerProvider
+}
+
+var (
+	tracingClient *TracingClient
+	tracingOnce   sync.Once
+)
+
+func InitTracing(appConfig *models.AppConfig) *TracingClient {
+	logger := utils.ComponentLogger("tracing")
+
+	tracingOnce.Do(func() {
+		tracingConfig := appConfig.Tracing
+		serviceName := tracingConfig.ServiceName
+		if serviceName == "" {
+			serviceName = "notification-service"
+		}
+		sampleRatio := tracingConfig.SampleRatio
+		if sampleRatio <= 0 {
+			sampleRatio = 1
+		}
+
+		options := []sdktrace.TracerProviderOption{
+			sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		}
+		if tracingConfig.Enabled {
+			exporterOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(tracingConfig.OtlpEndpoint)}
+			if tracingConfig.Insecure {
+				exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+			}
+			// the exporter connects lazily, an unreachable collector only loses spans.
+			exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("endpoint", tracingConfig.OtlpEndpoint).
+					Msg("Failed to create OTLP exporter, spans will not be exported")
+			} else {
+				options = append(options, sdktrace.WithBatcher(exporter))
+			}
+		}
+
+		tracingClient = &TracingClient{TracerProvider: sdktrace.NewTracerProvider(options...)}
+		otel.SetTracerProvider(tracingClient.TracerProvider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+		logger.Info().
+			Bool("export", tracingConfig.Enabled).
+			Str("endpoint", tracingConfig.OtlpEndpoint).
+			Float64("sample_ratio", sampleRatio).
+			Msg("Tracing initialized")
+	})
+	return tracingClient
+}
+
+func GetTracing() *TracingClient {
+	return tracingClient
+}
+
+// Shutdown exports the spans still buffered, until ctx is done, and stops the tracer provider.
+func (t *TracingClient) Shutdown(ctx context.Context) error {
+	return t.TracerProvider.Shutdown(ctx)
+}
@@ -2,10 +2,14 @@ package dao
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/utils"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
@@ -24,6 +28,11 @@ type RedisDao interface {
 
 var (
 	BLACKLISTED_NUMBERS_SET = "blacklisted_numbers_set"
+	LEASE_KEY_PREFIX        = "lease:"
+	CHECKPOINT_KEY_PREFIX   = "checkpoint:"
+	IDEMPOTENCY_KEY_PREFIX  = "idempotency:"
+	FREQUENCY_KEY_PREFIX    = "frequency:"
+	RATE_LIMIT_KEY_PREFIX   = "ratelimit:"
 )
 
 type RedisDaoImpl struct {
@@ -79,6 +88,7 @@ func setOptionalString(key string, option *string) {
 // function names should be defined such that they are easily understandable.
 func (r RedisDaoImpl) AddNumberToBlacklistedSet(ctx context.Context, numberToAdd string) error {
 	logger := utils.DatabaseLogger(ctx, "sadd", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "sadd", "blacklisted_numbers", time.Now())
 
 	logger.Info().
 		Str("phone_number", numberToAdd).
@@ -102,6 +112,7 @@ func (r RedisDaoImpl) AddNumberToBlacklistedSet(ctx context.Context, numberToAdd
 
 func (r RedisDaoImpl) CheckNumberInBlacklistedSet(ctx context.Context, numberToCheck string) (bool, error) {
 	logger := utils.DatabaseLogger(ctx, "sismember", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "sismember", "blacklisted_numbers", time.Now())
 
 	logger.Debug().
 		Str("phone_number", numberToCheck).
@@ -124,8 +135,51 @@ func (r RedisDaoImpl) CheckNumberInBlacklistedSet(ctx context.Context, numberToC
 	return exists, nil
 }
 
+// CheckNumbersInBlacklistedSet checks many numbers in one round trip, the result is in the order of numbers.
+// The numbers are split over several SMISMEMBER commands sent in a single pipeline to keep each command small.
+func (r RedisDaoImpl) CheckNumbersInBlacklistedSet(ctx context.Context, numbers []string) ([]bool, error) {
+	logger := utils.DatabaseLogger(ctx, "smismember", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "smismember", "blacklisted_numbers", time.Now())
+
+	logger.Debug().
+		Int("count", len(numbers)).
+		Msg("Checking numbers against blacklist")
+
+	const chunkSize = 1000
+	cmds := make([]*redis.BoolSliceCmd, 0, len(numbers)/chunkSize+1)
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for start := 0; start < len(numbers); start += chunkSize {
+			end := min(start+chunkSize, len(numbers))
+			members := make([]interface{}, 0, end-start)
+			for _, number := range numbers[start:end] {
+				members = append(members, number)
+			}
+			cmds = append(cmds, pipe.SMIsMember(ctx, BLACKLISTED_NUMBERS_SET, members...))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("count", len(numbers)).
+			Msg("Failed to check numbers in Redis blacklist")
+		return nil, errors.New("failed to check blacklist status")
+	}
+
+	results := make([]bool, 0, len(numbers))
+	for _, cmd := range cmds {
+		results = append(results, cmd.Val()...)
+	}
+
+	logger.Debug().
+		Int("count", len(numbers)).
+		Msg("Blacklist bulk check completed")
+	return results, nil
+}
+
 func (r RedisDaoImpl) GetAllBlacklistedNumbers(ctx context.Context) ([]string, error) {
 	logger := utils.DatabaseLogger(ctx, "smembers", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "smembers", "blacklisted_numbers", time.Now())
 
 	logger.Info().Msg("Retrieving all blacklisted numbers")
 
@@ -145,6 +199,7 @@ func (r RedisDaoImpl) GetAllBlacklistedNumbers(ctx context.Context) ([]string, e
 
 func (r RedisDaoImpl) RemoveFromBlacklistedSet(ctx context.Context, number string) (int64, error) {
 	logger := utils.DatabaseLogger(ctx, "srem", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "srem", "blacklisted_numbers", time.Now())
 
 	logger.Info().
 		Str("phone_number", number).
@@ -166,6 +221,326 @@ func (r RedisDaoImpl) RemoveFromBlacklistedSet(ctx context.Context, number strin
 	return removedCount, nil
 }
 
+// ReplaceBlacklistedNumbers swaps every old -> new entry of replacements in the blacklist in a single transaction,
+// so the blacklist never misses a number while it is rewritten.
+func (r RedisDaoImpl) ReplaceBlacklistedNumbers(ctx context.Context, replacements map[string]string) error {
+	logger := utils.DatabaseLogger(ctx, "multi", "blacklisted_numbers", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "multi", "blacklisted_numbers", time.Now())
+
+	if len(replacements) == 0 {
+		return nil
+	}
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for oldNumber, newNumber := range replacements {
+			pipe.SAdd(ctx, BLACKLISTED_NUMBERS_SET, newNumber)
+			pipe.SRem(ctx, BLACKLISTED_NUMBERS_SET, oldNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("count", len(replacements)).
+			Msg("Failed to replace blacklisted numbers")
+		return errors.New("failed to replace blacklisted numbers")
+	}
+
+	logger.Info().
+		Int("count", len(replacements)).
+		Msg("Successfully replaced blacklisted numbers")
+	return nil
+}
+
+// acquireLeaseScript takes the lease if it is free and renews it if the caller already holds it,
+// in one step so two replicas can never both believe they hold it.
+var acquireLeaseScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if current == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease only if the caller still holds it.
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLease takes or renews the named lease for owner. A lease that is not renewed within ttl
+// expires and can be taken by another replica.
+func (r RedisDaoImpl) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	logger := utils.DatabaseLogger(ctx, "acquire_lease", "leases", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "acquire_lease", "leases", time.Now())
+
+	acquired, err := acquireLeaseScript.Run(ctx, r.redisClient, []string{LEASE_KEY_PREFIX + name}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("lease", name).
+			Msg("Failed to acquire lease")
+		return false, errors.New("failed to acquire lease")
+	}
+	return acquired == 1, nil
+}
+
+func (r RedisDaoImpl) ReleaseLease(ctx context.Context, name, owner string) error {
+	logger := utils.DatabaseLogger(ctx, "release_lease", "leases", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "release_lease", "leases", time.Now())
+
+	err := releaseLeaseScript.Run(ctx, r.redisClient, []string{LEASE_KEY_PREFIX + name}, owner).Err()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("lease", name).
+			Msg("Failed to release lease")
+		return errors.New("failed to release lease")
+	}
+	return nil
+}
+
+// GetCheckpoint reads a named timestamp, ok is false when it was never set.
+func (r RedisDaoImpl) GetCheckpoint(ctx context.Context, name string) (time.Time, bool, error) {
+	logger := utils.DatabaseLogger(ctx, "get", "checkpoints", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "get", "checkpoints", time.Now())
+
+	millis, err := r.redisClient.Get(ctx, CHECKPOINT_KEY_PREFIX+name).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("checkpoint", name).
+			Msg("Failed to read checkpoint")
+		return time.Time{}, false, errors.New("failed to read checkpoint")
+	}
+	return time.UnixMilli(millis).UTC(), true, nil
+}
+
+func (r RedisDaoImpl) SetCheckpoint(ctx context.Context, name string, value time.Time) error {
+	logger := utils.DatabaseLogger(ctx, "set", "checkpoints", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "set", "checkpoints", time.Now())
+
+	err := r.redisClient.Set(ctx, CHECKPOINT_KEY_PREFIX+name, value.UnixMilli(), 0).Err()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("checkpoint", name).
+			Msg("Failed to write checkpoint")
+		return errors.New("failed to write checkpoint")
+	}
+	return nil
+}
+
+// ReserveIdempotencyKey stores record under key unless the key is already taken.
+// When it is taken, the stored record is returned and reserved is false.
+func (r RedisDaoImpl) ReserveIdempotencyKey(ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	logger := utils.DatabaseLogger(ctx, "setnx", "idempotency_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "setnx", "idempotency_keys", time.Now())
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reserved, err := r.redisClient.SetNX(ctx, IDEMPOTENCY_KEY_PREFIX+key, value, ttl).Result()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to reserve idempotency key")
+		return nil, false, errors.New("failed to reserve idempotency key")
+	}
+	if reserved {
+		return nil, true, nil
+	}
+
+	stored, err := r.redisClient.Get(ctx, IDEMPOTENCY_KEY_PREFIX+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// expired between the two calls, treat it as free on the caller's next attempt.
+		return nil, false, errors.New("idempotency key expired while being read")
+	}
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to read idempotency key")
+		return nil, false, errors.New("failed to read idempotency key")
+	}
+
+	var existing models.IdempotencyRecord
+	if err := json.Unmarshal(stored, &existing); err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+// SaveIdempotencyRecord overwrites the record under key, e.g. once the request completed.
+func (r RedisDaoImpl) SaveIdempotencyRecord(ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration) error {
+	logger := utils.DatabaseLogger(ctx, "set", "idempotency_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "set", "idempotency_keys", time.Now())
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = r.redisClient.Set(ctx, IDEMPOTENCY_KEY_PREFIX+key, value, ttl).Err()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to save idempotency record")
+		return errors.New("failed to save idempotency record")
+	}
+	return nil
+}
+
+func (r RedisDaoImpl) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	logger := utils.DatabaseLogger(ctx, "del", "idempotency_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "del", "idempotency_keys", time.Now())
+
+	err := r.redisClient.Del(ctx, IDEMPOTENCY_KEY_PREFIX+key).Err()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to delete idempotency key")
+		return errors.New("failed to delete idempotency key")
+	}
+	return nil
+}
+
+// frequencyCapScript keeps one sorted set per recipient and category, holding the request ids sent
+// to it scored by send time. It checks every window and records the request in one step, so two
+// workers cannot both take the last free slot. A request already in the set (a retry) is always allowed.
+// ARGV: now in ms, request id, longest window in ms, then window in ms / limit pairs.
+// It returns 0 when the request may be sent, otherwise the 1-based index of the limit that was hit.
+var frequencyCapScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - tonumber(ARGV[3]))
+if redis.call("ZSCORE", KEYS[1], ARGV[2]) then
+	return 0
+end
+for i = 4, #ARGV, 2 do
+	if redis.call("ZCOUNT", KEYS[1], now - tonumber(ARGV[i]), "+inf") >= tonumber(ARGV[i + 1]) then
+		return (i - 2) / 2
+	end
+end
+redis.call("ZADD", KEYS[1], now, ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 0
+`)
+
+// CheckFrequencyCaps records a send of requestId to the recipient key unless one of limits is
+// already reached, in which case the limit is returned and nothing is recorded. A send that then does
+// not happen gives its slot back with ReleaseFrequencyCap.
+func (r RedisDaoImpl) CheckFrequencyCaps(ctx context.Context, key, requestId string, limits []models.FrequencyLimit, now time.Time) (*models.FrequencyLimit, error) {
+	logger := utils.DatabaseLogger(ctx, "frequency_cap", "frequency_caps", requestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "frequency_cap", "frequency_caps", time.Now())
+
+	var longest time.Duration
+	args := []interface{}{now.UnixMilli(), requestId, 0}
+	for _, limit := range limits {
+		longest = max(longest, limit.Window)
+		args = append(args, limit.Window.Milliseconds(), limit.Limit)
+	}
+	args[2] = longest.Milliseconds()
+
+	hit, err := frequencyCapScript.Run(ctx, r.redisClient, []string{FREQUENCY_KEY_PREFIX + key}, args...).Int()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("key", key).
+			Msg("Failed to check frequency caps")
+		return nil, errors.New("failed to check frequency caps")
+	}
+	if hit == 0 {
+		return nil, nil
+	}
+	return &limits[hit-1], nil
+}
+
+// ReleaseFrequencyCap gives back the slot requestId took in the recipient key's windows, for a send that did not happen.
+func (r RedisDaoImpl) ReleaseFrequencyCap(ctx context.Context, key, requestId string) error {
+	logger := utils.DatabaseLogger(ctx, "zrem", "frequency_caps", requestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "zrem", "frequency_caps", time.Now())
+
+	err := r.redisClient.ZRem(ctx, FREQUENCY_KEY_PREFIX+key, requestId).Err()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("key", key).
+			Msg("Failed to release frequency cap slot")
+		return errors.New("failed to release frequency cap slot")
+	}
+	return nil
+}
+
+// tokenBucketScript refills the bucket for the time passed since it was last touched and takes one
+// token if there is one. Redis' own clock is used so every replica sees the same time.
+// ARGV: capacity, refill rate in tokens per ms.
+// It returns whether a token was taken, the tokens left, the ms until the next token and the ms until the bucket is full.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_after = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1000))
+return {allowed, math.floor(tokens), retry_after, reset}
+`)
+
+// RateLimitDecision is the outcome of taking a token from a rate limit bucket.
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until a token is available again, zero when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// TakeRateLimitToken takes one token from the bucket under key, holding at most capacity tokens
+// and refilled with refillPerSecond tokens every second.
+func (r RedisDaoImpl) TakeRateLimitToken(ctx context.Context, key string, capacity int, refillPerSecond float64) (*RateLimitDecision, error) {
+	logger := utils.DatabaseLogger(ctx, "token_bucket", "rate_limits", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "token_bucket", "rate_limits", time.Now())
+
+	result, err := tokenBucketScript.Run(ctx, r.redisClient, []string{RATE_LIMIT_KEY_PREFIX + key}, capacity, refillPerSecond/1000).Int64Slice()
+	if err != nil || len(result) != 4 {
+		logger.Error().
+			Err(err).
+			Str("key", key).
+			Msg("Failed to take rate limit token")
+		return nil, errors.New("failed to take rate limit token")
+	}
+	return &RateLimitDecision{
+		Allowed:    result[0] == 1,
+		Remaining:  int(result[1]),
+		RetryAfter: time.Duration(result[2]) * time.Millisecond,
+		Reset:      time.Duration(result[3]) * time.Millisecond,
+	}, nil
+}
+
 // in a struct we define a type, and then in the variables we define an ibject of that variable,
 // now while accessing, we set the object as
 // object_name = &type(
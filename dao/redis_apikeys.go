@@ -0,0 +1,167 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// api keys live in redis as json under API_KEY_PREFIX+id, together with the hash of their secret.
+// API_KEYS_SET holds every key id so the keys can be listed.
+
+var (
+	API_KEY_PREFIX = "apikey:"
+	API_KEYS_SET   = "apikeys"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyChanged  = errors.New("api key was changed concurrently")
+)
+
+// storedAPIKey is the redis value of a key, the secret hash never leaves the dao and the auth middleware.
+type storedAPIKey struct {
+	models.APIKey
+	SecretHash string `json:"secret_hash"`
+}
+
+// SaveAPIKey creates or overwrites a key.
+func (r RedisDaoImpl) SaveAPIKey(ctx context.Context, key models.APIKey, secretHash string) error {
+	logger := utils.DatabaseLogger(ctx, "set", "api_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "set", "api_keys", time.Now())
+
+	value, err := json.Marshal(storedAPIKey{APIKey: key, SecretHash: secretHash})
+	if err != nil {
+		return err
+	}
+	_, err = r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, API_KEY_PREFIX+key.ID, value, 0)
+		pipe.SAdd(ctx, API_KEYS_SET, key.ID)
+		return nil
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("key_id", key.ID).
+			Msg("Failed to save api key")
+		return errors.New("failed to save api key")
+	}
+	return nil
+}
+
+// replaceAPIKeyScript overwrites a key only if it exists, is not revoked and still has the secret hash the caller
+// read it with, so a rotation or revocation can never undo another one that happened in between.
+var replaceAPIKeyScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current == false then
+	return 0
+end
+local key = cjson.decode(current)
+if key["revoked_at"] ~= nil and key["revoked_at"] ~= cjson.null then
+	return 0
+end
+if key["secret_hash"] ~= ARGV[1] then
+	return -1
+end
+redis.call("SET", KEYS[1], ARGV[2])
+return 1
+`)
+
+// ReplaceActiveAPIKey overwrites an existing, not revoked key whose secret hash is still previousSecretHash.
+// It returns ErrAPIKeyNotFound when the key is gone or revoked, ErrAPIKeyChanged when its secret changed meanwhile.
+func (r RedisDaoImpl) ReplaceActiveAPIKey(ctx context.Context, key models.APIKey, previousSecretHash string, secretHash string) error {
+	logger := utils.DatabaseLogger(ctx, "replace", "api_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "replace", "api_keys", time.Now())
+
+	value, err := json.Marshal(storedAPIKey{APIKey: key, SecretHash: secretHash})
+	if err != nil {
+		return err
+	}
+	result, err := replaceAPIKeyScript.Run(ctx, r.redisClient, []string{API_KEY_PREFIX + key.ID}, previousSecretHash, value).Int()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("key_id", key.ID).
+			Msg("Failed to replace api key")
+		return errors.New("failed to save api key")
+	}
+	switch result {
+	case 0:
+		return ErrAPIKeyNotFound
+	case -1:
+		return ErrAPIKeyChanged
+	}
+	return nil
+}
+
+// GetAPIKey returns a key and the hash of its secret, ErrAPIKeyNotFound if there is no such key.
+func (r RedisDaoImpl) GetAPIKey(ctx context.Context, keyId string) (*models.APIKey, string, error) {
+	logger := utils.DatabaseLogger(ctx, "get", "api_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "get", "api_keys", time.Now())
+
+	value, err := r.redisClient.Get(ctx, API_KEY_PREFIX+keyId).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("key_id", keyId).
+			Msg("Failed to read api key")
+		return nil, "", errors.New("failed to read api key")
+	}
+
+	var stored storedAPIKey
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, "", err
+	}
+	return &stored.APIKey, stored.SecretHash, nil
+}
+
+func (r RedisDaoImpl) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	logger := utils.DatabaseLogger(ctx, "mget", "api_keys", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_REDIS, "mget", "api_keys", time.Now())
+
+	ids, err := r.redisClient.SMembers(ctx, API_KEYS_SET).Result()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to list api key ids")
+		return nil, errors.New("failed to list api keys")
+	}
+	if len(ids) == 0 {
+		return []models.APIKey{}, nil
+	}
+
+	redisKeys := make([]string, len(ids))
+	for i, id := range ids {
+		redisKeys[i] = API_KEY_PREFIX + id
+	}
+	values, err := r.redisClient.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to read api keys")
+		return nil, errors.New("failed to list api keys")
+	}
+
+	keys := make([]models.APIKey, 0, len(values))
+	for _, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var stored storedAPIKey
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			continue
+		}
+		keys = append(keys, stored.APIKey)
+	}
+	return keys, nil
+}
@@ -0,0 +1,65 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+// two admins rotate the same key at once, each with the secret hash they read. Only the first rotation
+// may land, the second must not hand out a secret that silently replaced the first one.
+func TestReplaceActiveAPIKeyRotatesOnce(t *testing.T) {
+	r, _ := newTestRedisDao(t)
+	ctx := context.Background()
+	key := models.APIKey{ID: "key-1", Owner: "billing", Scopes: []string{models.SCOPE_SMS_SEND}, CreatedAt: time.Now()}
+	if err := r.SaveAPIKey(ctx, key, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotatedAt := time.Now()
+	key.RotatedAt = &rotatedAt
+	if err := r.ReplaceActiveAPIKey(ctx, key, "hash-1", "hash-2"); err != nil {
+		t.Fatalf("ReplaceActiveAPIKey() error = %v", err)
+	}
+	if err := r.ReplaceActiveAPIKey(ctx, key, "hash-1", "hash-3"); !errors.Is(err, ErrAPIKeyChanged) {
+		t.Errorf("ReplaceActiveAPIKey() with a stale secret hash error = %v, want ErrAPIKeyChanged", err)
+	}
+
+	stored, secretHash, err := r.GetAPIKey(ctx, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secretHash != "hash-2" || stored.RotatedAt == nil {
+		t.Errorf("stored key has secret hash %q rotated at %v, want the first rotation", secretHash, stored.RotatedAt)
+	}
+}
+
+// a revoked key stays revoked, neither a rotation nor a second revocation read before it may bring it back.
+func TestReplaceActiveAPIKeyRefusesRevokedKey(t *testing.T) {
+	r, _ := newTestRedisDao(t)
+	ctx := context.Background()
+	key := models.APIKey{ID: "key-1", Owner: "billing", CreatedAt: time.Now()}
+	if err := r.SaveAPIKey(ctx, key, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := key
+	revokedAt := time.Now()
+	revoked.RevokedAt = &revokedAt
+	if err := r.ReplaceActiveAPIKey(ctx, revoked, "hash-1", "hash-1"); err != nil {
+		t.Fatalf("ReplaceActiveAPIKey() revoking the key error = %v", err)
+	}
+	if err := r.ReplaceActiveAPIKey(ctx, key, "hash-1", "hash-2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("ReplaceActiveAPIKey() of a revoked key error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if stored, _, err := r.GetAPIKey(ctx, "key-1"); err != nil || stored.RevokedAt == nil {
+		t.Errorf("GetAPIKey() = %v, %v, want the key still revoked", stored, err)
+	}
+
+	if err := r.ReplaceActiveAPIKey(ctx, models.APIKey{ID: "key-2"}, "hash-1", "hash-2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("ReplaceActiveAPIKey() of an unknown key error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisDao runs the dao against an in-memory redis, which also runs the lua scripts.
+func newTestRedisDao(t *testing.T) (RedisDaoImpl, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return RedisDaoImpl{redisClient: client}, server
+}
+
+var testFrequencyLimits = []models.FrequencyLimit{
+	{Window: time.Hour, Limit: 2},
+	{Window: 24 * time.Hour, Limit: 3},
+}
+
+func TestCheckFrequencyCapsHourlyLimit(t *testing.T) {
+	r, _ := newTestRedisDao(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, requestId := range []string{"req-1", "req-2"} {
+		if hit, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", requestId, testFrequencyLimits, now.Add(time.Duration(i)*time.Minute)); err != nil || hit != nil {
+			t.Fatalf("CheckFrequencyCaps(%s) = %v, %v, want it allowed", requestId, hit, err)
+		}
+	}
+
+	hit, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", "req-3", testFrequencyLimits, now.Add(2*time.Minute))
+	if err != nil || hit == nil || hit.Window != time.Hour {
+		t.Fatalf("CheckFrequencyCaps(req-3) = %v, %v, want the hourly limit hit", hit, err)
+	}
+
+	// a refused request takes no slot, and once the hour passed the recipient can be sent to again.
+	if hit, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", "req-3", testFrequencyLimits, now.Add(61*time.Minute)); err != nil || hit != nil {
+		t.Errorf("CheckFrequencyCaps(req-3) an hour later = %v, %v, want it allowed", hit, err)
+	}
+	// the daily limit counts all three.
+	hit, err = r.CheckFrequencyCaps(ctx, "+919812345678:otp", "req-4", testFrequencyLimits, now.Add(3*time.Hour))
+	if err != nil || hit == nil || hit.Window != 24*time.Hour {
+		t.Errorf("CheckFrequencyCaps(req-4) = %v, %v, want the daily limit hit", hit, err)
+	}
+}
+
+// a retry of a request that already holds a slot must not be capped by its own earlier attempt.
+func TestCheckFrequencyCapsAllowsRetry(t *testing.T) {
+	r, _ := newTestRedisDao(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, requestId := range []string{"req-1", "req-2", "req-2"} {
+		if hit, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", requestId, testFrequencyLimits, now); err != nil || hit != nil {
+			t.Fatalf("CheckFrequencyCaps(%s) = %v, %v, want it allowed", requestId, hit, err)
+		}
+	}
+	if hit, _ := r.CheckFrequencyCaps(ctx, "+919812345678:otp", "req-3", testFrequencyLimits, now); hit == nil {
+		t.Errorf("CheckFrequencyCaps(req-3) allowed, want the retry of req-2 to have taken no second slot")
+	}
+}
+
+func TestReleaseFrequencyCap(t *testing.T) {
+	r, server := newTestRedisDao(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, requestId := range []string{"req-1", "req-2"} {
+		if _, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", requestId, testFrequencyLimits, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.ReleaseFrequencyCap(ctx, "+919812345678:otp", "req-2"); err != nil {
+		t.Fatalf("ReleaseFrequencyCap() error = %v", err)
+	}
+	if members, _ := server.ZMembers(FREQUENCY_KEY_PREFIX + "+919812345678:otp"); len(members) != 1 || members[0] != "req-1" {
+		t.Errorf("slots held = %q, want only req-1", members)
+	}
+	if hit, err := r.CheckFrequencyCaps(ctx, "+919812345678:otp", "req-3", testFrequencyLimits, now); err != nil || hit != nil {
+		t.Errorf("CheckFrequencyCaps(req-3) = %v, %v, want the released slot used", hit, err)
+	}
+}
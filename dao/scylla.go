@@ -2,23 +2,50 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/gocql/gocql"
 	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
 	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/utils"
 	"github.com/scylladb/gocqlx/v2"
 	"github.com/scylladb/gocqlx/v2/qb"
+	"golang.org/x/sync/errgroup"
 )
 
 type ScyllaDbDao interface {
 	// list all the methods being implemented
 	InsertSMSRequest(ctx context.Context, sms models.AddSmsEntryInDb) error
+	InsertSMSRequestsBatch(ctx context.Context, smsList []models.AddSmsEntryInDb) []error
 	GetSMSDetailsFromDB(ctx context.Context, requestId string) (*models.SMSRequest, error)
-	UpdateSMSDetailsInDB(ctx context.Context, smsDetails *models.SMSRequest) error
+	UpdateSMSDetailsInDB(ctx context.Context, smsDetails *models.SMSRequest, fromStatus models.SMSStatus) error
+	RecordKafkaPosition(ctx context.Context, requestId string, partition int32, offset int64) error
+	InsertProviderMessageMapping(ctx context.Context, provider, providerMessageId, requestId string) error
+	GetRequestIdByProviderMessageId(ctx context.Context, provider, providerMessageId string) (string, error)
+	GetDueScheduledSMS(ctx context.Context, bucket time.Time, until time.Time) ([]models.ScheduledSMS, error)
+	HasScheduledSMS(ctx context.Context, bucket time.Time) (bool, error)
+	DeleteScheduledSMS(ctx context.Context, entry models.ScheduledSMS) error
+	MoveScheduledSMSToOutbox(ctx context.Context, entry models.ScheduledSMS, sms models.SMSRequest) error
+	GetOutboxEntries(ctx context.Context, shard int, limit int) ([]models.OutboxEntry, error)
+	DeleteOutboxEntries(ctx context.Context, shard int, entries []models.OutboxEntry) error
+	InsertTemplateVersion(ctx context.Context, template models.SMSTemplate) (bool, error)
+	GetTemplate(ctx context.Context, tenantId string, templateId string, version int) (*models.SMSTemplate, error)
+	GetTemplateVersions(ctx context.Context, tenantId string, templateId string) ([]models.SMSTemplate, error)
+	DeleteTemplate(ctx context.Context, tenantId string, templateId string) error
+	GetSMSHistoryByPhone(ctx context.Context, tenantId, phoneNumber string, from, to time.Time, limit int, pageState []byte) ([]models.SMSHistoryEntry, []byte, error)
+	GetSMSDetailsByIds(ctx context.Context, requestIds []string) ([]models.SMSRequest, error)
+	GetSMSByStatus(ctx context.Context, tenantId string, status models.SMSStatus, bucket time.Time, since time.Time, limit int, pageState []byte) ([]models.SMSStatusEntry, []byte, error)
+	GetSMSByStatusBefore(ctx context.Context, tenantId string, status models.SMSStatus, bucket time.Time, until time.Time, limit int) ([]models.SMSStatusEntry, error)
+	DeleteStatusIndexEntry(ctx context.Context, entry models.SMSStatusEntry) error
 }
 
+// ErrConcurrentUpdate is returned when a conditional update finds the row no longer in the
+// status the caller read it in, i.e. another worker changed it first.
+var ErrConcurrentUpdate = errors.New("sms request was modified concurrently")
+
 type ScyllaDbDaoImpl struct {
 	// this will have a scylladb client/session
 	scyllaSession *gocqlx.Session
@@ -44,38 +71,65 @@ func GetScyllaSession() *ScyllaDbDaoImpl {
 	return scyllaDbSession
 }
 
+var smsRequestInsertColumns = []string{
+	"id",
+	"tenant_id",
+	"sender_id",
+	"channel",
+	"phone_number",
+	"category",
+	"message",
+	"encoding",
+	"segment_count",
+	"status",
+	"failure_code",
+	"failure_comments",
+	"template_id",
+	"template_version",
+	"send_at",
+	"attempts",
+	"created_at",
+	"updated_at",
+}
+
+var smsRequestSelectColumns = []string{"id", "tenant_id", "sender_id", "channel", "phone_number", "category", "message", "encoding", "segment_count", "status", "failure_code", "failure_comments", "provider", "provider_message_id", "carrier_error_code", "delivered_at", "template_id", "template_version", "send_at", "attempts", "kafka_partition", "kafka_offset", "created_at", "updated_at"}
+
+// initialStatus is Scheduled for messages with a send_at, Pending otherwise.
+func initialStatus(sms models.AddSmsEntryInDb) models.SMSStatus {
+	if !sms.SendAt.IsZero() {
+		return models.SMS_STATUS_SCHEDULED
+	}
+	return models.SMS_STATUS_PENDING
+}
+
+// smsReleaseInsert is the entry a new request is handed to kafka from: the scheduler's for a scheduled
+// message, the outbox relay's for any other.
+func smsReleaseInsert(sms models.AddSmsEntryInDb, now time.Time) (string, []interface{}) {
+	if !sms.SendAt.IsZero() {
+		return scheduledSMSInsert(sms)
+	}
+	return smsOutboxInsert(sms, now)
+}
+
+// smsRequestInsertValues returns the values for smsRequestInsertColumns, in order.
+func smsRequestInsertValues(sms models.AddSmsEntryInDb, now time.Time) []interface{} {
+	return []interface{}{sms.RequestID, sms.TenantID, sms.SenderId, sms.Channel, sms.PhoneNumber, sms.Category, sms.Message, sms.Encoding, sms.SegmentCount, initialStatus(sms), "", "", sms.TemplateID, sms.TemplateVersion, sms.SendAt, 0, now, now}
+}
+
 // Example: Insert into sms_requests using gocqlx/qb
+// The request is written together with its sms_by_phone and sms_by_status entries, and with its scheduled_sms entry
+// when it is scheduled or its sms_outbox entry otherwise, in a logged batch, so a request can never exist without
+// the indexes it is looked up and released from.
 func (session ScyllaDbDaoImpl) InsertSMSRequest(ctx context.Context, sms models.AddSmsEntryInDb) error {
 	logger := utils.DatabaseLogger(ctx, "insert", "sms_requests", sms.RequestID)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "insert", "sms_requests", time.Now())
 
 	logger.Info().
 		Str("phone_number", sms.PhoneNumber).
 		Str("message_preview", sms.Message[:min(len(sms.Message), 50)]).
 		Msg("Attempting to insert SMS request")
 
-	query := qb.Insert("sms_requests").
-		Columns("id",
-			"phone_number",
-			"message",
-			"status",
-			"failure_code",
-			"failure_comments",
-			"created_at",
-			"updated_at").
-		QueryContext(ctx, *session.scyllaSession)
-
-	insertMap := qb.M{
-		"id":               sms.RequestID,
-		"phone_number":     sms.PhoneNumber,
-		"message":          sms.Message,
-		"status":           "Pending", // replace with an enum value
-		"failure_code":     "",
-		"failure_comments": "",
-		"created_at":       time.Now(),
-		"updated_at":       time.Now(),
-	}
-
-	err := query.BindMap(insertMap).ExecRelease()
+	err := session.scyllaSession.ExecuteBatch(session.smsRequestBatch(ctx, sms, time.Now()))
 	if err != nil {
 		logger.Error().
 			Err(err).
@@ -86,19 +140,84 @@ func (session ScyllaDbDaoImpl) InsertSMSRequest(ctx context.Context, sms models.
 
 	logger.Info().
 		Str("phone_number", sms.PhoneNumber).
+		Str("status", string(initialStatus(sms))).
 		Msg("Successfully inserted SMS request into database")
 	return nil
 }
 
+// smsRequestBatch is the logged batch a new request is written in, see InsertSMSRequest.
+func (session ScyllaDbDaoImpl) smsRequestBatch(ctx context.Context, sms models.AddSmsEntryInDb, now time.Time) *gocql.Batch {
+	stmt, _ := qb.Insert("sms_requests").Columns(smsRequestInsertColumns...).ToCql()
+	historyStmt, historyArgs := smsHistoryInsert(sms, now)
+	batch := session.scyllaSession.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(stmt, smsRequestInsertValues(sms, now)...)
+	batch.Query(historyStmt, historyArgs...)
+	statusStmt, statusArgs := smsStatusIndexInsert(sms.TenantID, initialStatus(sms), now, sms.RequestID)
+	batch.Query(statusStmt, statusArgs...)
+	releaseStmt, releaseArgs := smsReleaseInsert(sms, now)
+	batch.Query(releaseStmt, releaseArgs...)
+	return batch
+}
+
+// MAX_CONCURRENT_REQUEST_WRITES is how many requests InsertSMSRequestsBatch writes at the same time.
+const MAX_CONCURRENT_REQUEST_WRITES = 16
+
+// InsertSMSRequestsBatch writes every request atomically with its indexes and outbox entry, in its own logged batch
+// like InsertSMSRequest, up to MAX_CONCURRENT_REQUEST_WRITES of them at a time. A batch spanning several requests
+// would either lose atomicity or grow past what a logged batch should carry, so the requests succeed or fail
+// one by one; the returned errors line up with smsList, nil for a stored request.
+func (session ScyllaDbDaoImpl) InsertSMSRequestsBatch(ctx context.Context, smsList []models.AddSmsEntryInDb) []error {
+	logger := utils.DatabaseLogger(ctx, "batch_insert", "sms_requests", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "batch_insert", "sms_requests", time.Now())
+
+	logger.Info().
+		Int("count", len(smsList)).
+		Msg("Attempting to insert SMS requests batch")
+
+	now := time.Now()
+	errs := make([]error, len(smsList))
+	// a failed request does not stop the others, so the group's own error is never set.
+	var writes errgroup.Group
+	writes.SetLimit(MAX_CONCURRENT_REQUEST_WRITES)
+	for i := range smsList {
+		writes.Go(func() error {
+			errs[i] = session.scyllaSession.ExecuteBatch(session.smsRequestBatch(ctx, smsList[i], now))
+			return nil
+		})
+	}
+	_ = writes.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		logger.Error().
+			Err(err).
+			Str("request_id", smsList[i].RequestID).
+			Str("phone_number", smsList[i].PhoneNumber).
+			Msg("Failed to insert SMS request of batch into database")
+	}
+
+	logger.Info().
+		Int("count", len(smsList)).
+		Int("failed", failed).
+		Msg("Inserted SMS requests batch into database")
+	return errs
+}
+
 // okay now we have to create a scylla entry in the keyspace and the table specified, the request must be of the valid DTO, and then it should update it.
+// GetSMSDetailsFromDB reads a request whatever its tenant, anything serving an api caller checks the tenant of the row.
 func (session ScyllaDbDaoImpl) GetSMSDetailsFromDB(ctx context.Context, requestId string) (*models.SMSRequest, error) {
 	logger := utils.DatabaseLogger(ctx, "select", "sms_requests", requestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_requests", time.Now())
 
 	logger.Info().Msg("Attempting to retrieve SMS request from database")
 
 	var data models.SMSRequest
 	query := qb.Select("sms_requests").
-		Columns("id", "phone_number", "message", "status", "failure_code", "failure_comments", "created_at", "updated_at").
+		Columns(smsRequestSelectColumns...).
 		Where(qb.Eq("id")).
 		QueryContext(ctx, *session.scyllaSession)
 
@@ -115,16 +234,22 @@ func (session ScyllaDbDaoImpl) GetSMSDetailsFromDB(ctx context.Context, requestI
 
 	logger.Info().
 		Str("phone_number", data.PhoneNumber).
-		Str("status", data.Status).
+		Str("status", string(data.Status)).
 		Msg("Successfully retrieved SMS request from database")
 	return &data, nil
 }
 
-func (session ScyllaDbDaoImpl) UpdateSMSDetailsInDB(ctx context.Context, smsDetails *models.SMSRequest) error {
+// UpdateSMSDetailsInDB persists a status change of the request. The update is a lightweight
+// transaction conditioned on the row still being in fromStatus, so two workers can never both
+// move the same request; the loser gets ErrConcurrentUpdate. Once applied, the request's
+// sms_by_status entry is moved along.
+func (session ScyllaDbDaoImpl) UpdateSMSDetailsInDB(ctx context.Context, smsDetails *models.SMSRequest, fromStatus models.SMSStatus) error {
 	logger := utils.DatabaseLogger(ctx, "update", "sms_requests", smsDetails.ID)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "update", "sms_requests", time.Now())
 
 	logger.Info().
-		Str("new_status", smsDetails.Status).
+		Str("from_status", string(fromStatus)).
+		Str("new_status", string(smsDetails.Status)).
 		Msg("Attempting to update SMS request in database")
 
 	// Build the update query
@@ -133,48 +258,170 @@ func (session ScyllaDbDaoImpl) UpdateSMSDetailsInDB(ctx context.Context, smsDeta
 			"status",
 			"failure_code",
 			"failure_comments",
+			"provider",
+			"provider_message_id",
+			"carrier_error_code",
+			"delivered_at",
+			"attempts",
 			"updated_at",
 		).
 		Where(qb.Eq("id")).
+		If(qb.EqNamed("status", "from_status")).
 		QueryContext(ctx, *session.scyllaSession)
 
-	// this is a mechanism to fill in some default values into the db.
-	status := smsDetails.Status
-	if status == "" {
-		status = "Success"
-	}
-	failureCode := smsDetails.FailureCode
-	if failureCode == "" {
-		failureCode = "null"
-	}
-	failureComments := smsDetails.FailureComments
-	if failureComments == "" {
-		failureComments = "null"
-	}
+	updatedAt := time.Now()
 	updateMap := qb.M{
-		"id":               smsDetails.ID,
-		"status":           status,
-		"failure_code":     failureCode,
-		"failure_comments": failureComments,
-		"updated_at":       time.Now(),
+		"id":                  smsDetails.ID,
+		"status":              smsDetails.Status,
+		"failure_code":        smsDetails.FailureCode,
+		"failure_comments":    smsDetails.FailureComments,
+		"provider":            smsDetails.Provider,
+		"provider_message_id": smsDetails.ProviderMessageId,
+		"carrier_error_code":  smsDetails.CarrierErrorCode,
+		"delivered_at":        smsDetails.DeliveredAt,
+		"attempts":            smsDetails.Attempts,
+		"updated_at":          updatedAt,
+		"from_status":         fromStatus,
 	}
 
-	err := query.BindMap(updateMap).ExecRelease()
+	applied, err := query.BindMap(updateMap).ExecCASRelease()
 	if err != nil {
 		logger.Error().
 			Err(err).
-			Str("new_status", status).
-			Str("failure_code", failureCode).
+			Str("new_status", string(smsDetails.Status)).
+			Str("failure_code", smsDetails.FailureCode).
 			Msg("Failed to update SMS request in database")
 		return err
 	}
+	if !applied {
+		logger.Warn().
+			Str("from_status", string(fromStatus)).
+			Str("new_status", string(smsDetails.Status)).
+			Msg("SMS request status changed concurrently, update not applied")
+		return ErrConcurrentUpdate
+	}
+	fromUpdatedAt := smsDetails.UpdatedAt
+	smsDetails.UpdatedAt = updatedAt
+	session.moveStatusIndexEntry(ctx, smsDetails, fromStatus, fromUpdatedAt)
 
 	logger.Info().
-		Str("new_status", status).
+		Str("new_status", string(smsDetails.Status)).
 		Msg("Successfully updated SMS request in database")
 	return nil
 }
 
+// RecordKafkaPosition stores the partition and offset the broker acknowledged the request's message at.
+// The columns are left out of UpdateSMSDetailsInDB, so a status change never overwrites them with
+// what its caller read before the acknowledgement arrived.
+func (session ScyllaDbDaoImpl) RecordKafkaPosition(ctx context.Context, requestId string, partition int32, offset int64) error {
+	logger := utils.DatabaseLogger(ctx, "update", "sms_requests", requestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "update_kafka_position", "sms_requests", time.Now())
+
+	applied, err := qb.Update("sms_requests").
+		Set("kafka_partition", "kafka_offset").
+		Where(qb.Eq("id")).
+		Existing().
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{
+			"id":              requestId,
+			"kafka_partition": partition,
+			"kafka_offset":    offset,
+		}).
+		ExecCASRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int32("partition", partition).
+			Int64("offset", offset).
+			Msg("Failed to record Kafka position of SMS request")
+		return err
+	}
+	if !applied {
+		return gocql.ErrNotFound
+	}
+	return nil
+}
+
+// InsertProviderMessageMapping records which request a provider message id belongs to,
+// so delivery receipts, which only carry the provider's id, can be matched back to the request.
+func (session ScyllaDbDaoImpl) InsertProviderMessageMapping(ctx context.Context, provider, providerMessageId, requestId string) error {
+	logger := utils.DatabaseLogger(ctx, "insert", "sms_provider_messages", requestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "insert", "sms_provider_messages", time.Now())
+
+	query := qb.Insert("sms_provider_messages").
+		Columns("provider", "provider_message_id", "request_id", "created_at").
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"provider":            provider,
+		"provider_message_id": providerMessageId,
+		"request_id":          requestId,
+		"created_at":          time.Now(),
+	}).ExecRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("provider", provider).
+			Str("provider_message_id", providerMessageId).
+			Msg("Failed to insert provider message mapping")
+		return err
+	}
+
+	logger.Info().
+		Str("provider", provider).
+		Str("provider_message_id", providerMessageId).
+		Msg("Successfully inserted provider message mapping")
+	return nil
+}
+
+func (session ScyllaDbDaoImpl) GetRequestIdByProviderMessageId(ctx context.Context, provider, providerMessageId string) (string, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_provider_messages", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_provider_messages", time.Now())
+
+	var requestId string
+	query := qb.Select("sms_provider_messages").
+		Columns("request_id").
+		Where(qb.Eq("provider"), qb.Eq("provider_message_id")).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"provider":            provider,
+		"provider_message_id": providerMessageId,
+	}).GetRelease(&requestId)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("provider", provider).
+			Str("provider_message_id", providerMessageId).
+			Msg("Failed to look up request by provider message id")
+		return "", err
+	}
+
+	return requestId, nil
+}
+
+// scanPage reads the rows of the page the iterator fetched, without fetching the next one,
+// and returns them with the paging state of the next page, nil when there is none.
+func scanPage[T any](iter *gocqlx.Iterx) ([]T, []byte, error) {
+	rows := make([]T, 0, iter.NumRows())
+	for n := iter.NumRows(); n > 0; n-- {
+		var row T
+		if !iter.StructScan(&row) {
+			break
+		}
+		rows = append(rows, row)
+	}
+	pageState := iter.PageState()
+	err := iter.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pageState) == 0 {
+		pageState = nil
+	}
+	return rows, pageState, nil
+}
+
 // Helper function for min operation
 func min(a, b int) int {
 	if a < b {
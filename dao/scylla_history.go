@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// this file has the queries on sms_by_phone, the message history of a recipient. a partition holds one
+// tenant's requests to one phone number, clustered newest first, so a time window is a single slice of it.
+
+var smsHistoryColumns = []string{"tenant_id", "phone_number", "created_at", "request_id"}
+
+func smsHistoryInsert(sms models.AddSmsEntryInDb, createdAt time.Time) (string, []interface{}) {
+	stmt, _ := qb.Insert("sms_by_phone").
+		Columns(smsHistoryColumns...).
+		ToCql()
+	return stmt, []interface{}{sms.TenantID, sms.PhoneNumber, createdAt, sms.RequestID}
+}
+
+// GetSMSHistoryByPhone returns one page of at most limit entries created between from and to, newest first,
+// and the paging state of the next page, nil on the last one.
+func (session ScyllaDbDaoImpl) GetSMSHistoryByPhone(ctx context.Context, tenantId, phoneNumber string, from, to time.Time, limit int, pageState []byte) ([]models.SMSHistoryEntry, []byte, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_by_phone", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_by_phone", time.Now())
+
+	iter := qb.Select("sms_by_phone").
+		Columns(smsHistoryColumns...).
+		Where(qb.Eq("tenant_id"), qb.Eq("phone_number"), qb.GtOrEqNamed("created_at", "from"), qb.LtOrEqNamed("created_at", "to")).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"tenant_id": tenantId, "phone_number": phoneNumber, "from": from, "to": to}).
+		PageSize(limit).
+		PageState(pageState).
+		Iter()
+
+	entries, nextPageState, err := scanPage[models.SMSHistoryEntry](iter)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("phone_number", phoneNumber).
+			Msg("Failed to retrieve SMS history")
+		return nil, nil, err
+	}
+
+	logger.Debug().
+		Str("phone_number", phoneNumber).
+		Int("count", len(entries)).
+		Msg("Retrieved SMS history page")
+	return entries, nextPageState, nil
+}
+
+// GetSMSDetailsByIds reads many requests in one query, in no particular order. Missing ids are left out.
+func (session ScyllaDbDaoImpl) GetSMSDetailsByIds(ctx context.Context, requestIds []string) ([]models.SMSRequest, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_requests", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_requests", time.Now())
+
+	if len(requestIds) == 0 {
+		return nil, nil
+	}
+	var requests []models.SMSRequest
+	err := qb.Select("sms_requests").
+		Columns(smsRequestSelectColumns...).
+		Where(qb.In("id")).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"id": requestIds}).
+		SelectRelease(&requests)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("count", len(requestIds)).
+			Msg("Failed to retrieve SMS requests")
+		return nil, err
+	}
+	return requests, nil
+}
@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// this file has the queries on sms_outbox, the requests that are stored but not yet on kafka. An entry is
+// written in the same logged batch as its request and deleted by the outbox relay once the broker
+// acknowledged the request's message, so a request is always either on kafka or in the outbox.
+// entries are spread over a fixed number of shards by request id, each shard is one partition read oldest first.
+
+// DEFAULT_OUTBOX_SHARDS is the number of shards when outbox.shards is not set.
+const DEFAULT_OUTBOX_SHARDS = 16
+
+var smsOutboxColumns = []string{"shard", "created_at", "request_id", "tenant_id", "channel", "phone_number", "trace_context"}
+
+func OutboxShards() int {
+	if shards := config.GetAppConfig().Outbox.Shards; shards > 0 {
+		return shards
+	}
+	return DEFAULT_OUTBOX_SHARDS
+}
+
+// OutboxShard returns the shard a request's outbox entry is written to.
+func OutboxShard(requestId string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(requestId))
+	return int(hash.Sum32() % uint32(OutboxShards()))
+}
+
+func smsOutboxInsert(sms models.AddSmsEntryInDb, now time.Time) (string, []interface{}) {
+	stmt, _ := qb.Insert("sms_outbox").Columns(smsOutboxColumns...).ToCql()
+	return stmt, []interface{}{OutboxShard(sms.RequestID), now, sms.RequestID, sms.TenantID, sms.Channel, sms.PhoneNumber, sms.TraceContext}
+}
+
+// GetOutboxEntries returns up to limit entries of a shard, oldest first.
+func (session ScyllaDbDaoImpl) GetOutboxEntries(ctx context.Context, shard int, limit int) ([]models.OutboxEntry, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_outbox", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_outbox", time.Now())
+
+	var entries []models.OutboxEntry
+	query := qb.Select("sms_outbox").
+		Columns(smsOutboxColumns...).
+		Where(qb.Eq("shard")).
+		Limit(uint(limit)).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"shard": shard,
+	}).SelectRelease(&entries)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("shard", shard).
+			Msg("Failed to read outbox entries")
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteOutboxEntries removes relayed entries of one shard, in a single partition batch.
+func (session ScyllaDbDaoImpl) DeleteOutboxEntries(ctx context.Context, shard int, entries []models.OutboxEntry) error {
+	logger := utils.DatabaseLogger(ctx, "delete", "sms_outbox", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "delete", "sms_outbox", time.Now())
+
+	stmt, _ := qb.Delete("sms_outbox").
+		Where(qb.Eq("shard"), qb.Eq("created_at"), qb.Eq("request_id")).
+		ToCql()
+	batch := session.scyllaSession.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	for _, entry := range entries {
+		batch.Query(stmt, shard, entry.CreatedAt, entry.RequestId)
+	}
+
+	err := session.scyllaSession.ExecuteBatch(batch)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("shard", shard).
+			Int("count", len(entries)).
+			Msg("Failed to delete outbox entries")
+		return err
+	}
+	return nil
+}
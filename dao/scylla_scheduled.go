@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// this file has the queries on scheduled_sms, the index of messages waiting for their send_at.
+// the table is partitioned by a time bucket so the scheduler only ever reads small partitions.
+
+var scheduledSMSColumns = []string{"bucket", "send_at", "request_id", "trace_context"}
+
+// ScheduleBucket returns the scheduled_sms partition a send_at falls into.
+func ScheduleBucket(sendAt time.Time) time.Time {
+	bucketSize := config.GetAppConfig().Scheduler.BucketSize
+	if bucketSize <= 0 {
+		bucketSize = time.Minute
+	}
+	return sendAt.UTC().Truncate(bucketSize)
+}
+
+func scheduledSMSInsert(sms models.AddSmsEntryInDb) (string, []interface{}) {
+	stmt, _ := qb.Insert("scheduled_sms").
+		Columns(scheduledSMSColumns...).
+		ToCql()
+	return stmt, []interface{}{ScheduleBucket(sms.SendAt), sms.SendAt, sms.RequestID, sms.TraceContext}
+}
+
+// GetDueScheduledSMS returns the entries of a bucket whose send_at is not after until, oldest first.
+func (session ScyllaDbDaoImpl) GetDueScheduledSMS(ctx context.Context, bucket time.Time, until time.Time) ([]models.ScheduledSMS, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "scheduled_sms", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "scheduled_sms", time.Now())
+
+	var entries []models.ScheduledSMS
+	query := qb.Select("scheduled_sms").
+		Columns(scheduledSMSColumns...).
+		Where(qb.Eq("bucket"), qb.LtOrEq("send_at")).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"bucket":  bucket,
+		"send_at": until,
+	}).SelectRelease(&entries)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Time("bucket", bucket).
+			Msg("Failed to read due scheduled SMS requests")
+		return nil, err
+	}
+
+	logger.Debug().
+		Time("bucket", bucket).
+		Int("count", len(entries)).
+		Msg("Read due scheduled SMS requests")
+	return entries, nil
+}
+
+// HasScheduledSMS reports whether a bucket still has entries waiting to be released.
+func (session ScyllaDbDaoImpl) HasScheduledSMS(ctx context.Context, bucket time.Time) (bool, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "scheduled_sms", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "scheduled_sms", time.Now())
+
+	var entries []models.ScheduledSMS
+	query := qb.Select("scheduled_sms").
+		Columns("bucket", "send_at", "request_id").
+		Where(qb.Eq("bucket")).
+		Limit(1).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"bucket": bucket,
+	}).SelectRelease(&entries)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Time("bucket", bucket).
+			Msg("Failed to check scheduled SMS bucket")
+		return false, err
+	}
+	return len(entries) > 0, nil
+}
+
+// DeleteScheduledSMS removes an entry once it has been released (or can never be).
+func (session ScyllaDbDaoImpl) DeleteScheduledSMS(ctx context.Context, entry models.ScheduledSMS) error {
+	logger := utils.DatabaseLogger(ctx, "delete", "scheduled_sms", entry.RequestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "delete", "scheduled_sms", time.Now())
+
+	query := qb.Delete("scheduled_sms").
+		Where(qb.Eq("bucket"), qb.Eq("send_at"), qb.Eq("request_id")).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"bucket":     entry.Bucket,
+		"send_at":    entry.SendAt,
+		"request_id": entry.RequestId,
+	}).ExecRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to delete scheduled SMS entry")
+		return err
+	}
+	return nil
+}
+
+// MoveScheduledSMSToOutbox writes the outbox entry of a released request and deletes its scheduled entry in one
+// logged batch, so a due request is always in one of the two and the relay produces it from the outbox.
+func (session ScyllaDbDaoImpl) MoveScheduledSMSToOutbox(ctx context.Context, entry models.ScheduledSMS, sms models.SMSRequest) error {
+	logger := utils.DatabaseLogger(ctx, "batch_move", "scheduled_sms", entry.RequestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "batch_move", "scheduled_sms", time.Now())
+
+	outboxStmt, outboxArgs := smsOutboxInsert(models.AddSmsEntryInDb{
+		RequestID:    entry.RequestId,
+		TenantID:     sms.TenantID,
+		Channel:      sms.Channel,
+		PhoneNumber:  sms.PhoneNumber,
+		TraceContext: entry.TraceContext,
+	}, time.Now())
+	deleteStmt, _ := qb.Delete("scheduled_sms").
+		Where(qb.Eq("bucket"), qb.Eq("send_at"), qb.Eq("request_id")).
+		ToCql()
+
+	batch := session.scyllaSession.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(outboxStmt, outboxArgs...)
+	batch.Query(deleteStmt, entry.Bucket, entry.SendAt, entry.RequestId)
+	err := session.scyllaSession.ExecuteBatch(batch)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to move scheduled SMS entry to the outbox")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// this file has the queries on sms_by_status, the index of requests by their current status. a partition
+// holds one tenant's requests that moved into a status on one day, clustered by the time of that change,
+// newest first. Every status change moves the request's entry, so a request is listed under one status only.
+
+// STATUS_BUCKET_SIZE is the width of a sms_by_status partition, it must never change once data exists.
+const STATUS_BUCKET_SIZE = 24 * time.Hour
+
+var smsStatusIndexColumns = []string{"tenant_id", "status", "bucket", "updated_at", "request_id"}
+
+// StatusBucket returns the sms_by_status partition a status change at updatedAt falls into.
+func StatusBucket(updatedAt time.Time) time.Time {
+	return updatedAt.UTC().Truncate(STATUS_BUCKET_SIZE)
+}
+
+// statusIndexTenant is the tenant a request is indexed under, rows written before tenants existed belong to the default one.
+func statusIndexTenant(tenantId string) string {
+	if tenantId == "" {
+		return models.DEFAULT_TENANT
+	}
+	return tenantId
+}
+
+func smsStatusIndexInsert(tenantId string, status models.SMSStatus, updatedAt time.Time, requestId string) (string, []interface{}) {
+	builder := qb.Insert("sms_by_status").Columns(smsStatusIndexColumns...)
+	if ttl := config.GetAppConfig().Sms.StatusIndexTtl; ttl > 0 {
+		builder = builder.TTL(ttl)
+	}
+	stmt, _ := builder.ToCql()
+	return stmt, []interface{}{statusIndexTenant(tenantId), status, StatusBucket(updatedAt), updatedAt, requestId}
+}
+
+func smsStatusIndexDelete(tenantId string, status models.SMSStatus, updatedAt time.Time, requestId string) (string, []interface{}) {
+	stmt, _ := qb.Delete("sms_by_status").
+		Where(qb.Eq("tenant_id"), qb.Eq("status"), qb.Eq("bucket"), qb.Eq("updated_at"), qb.Eq("request_id")).
+		ToCql()
+	return stmt, []interface{}{statusIndexTenant(tenantId), status, StatusBucket(updatedAt), updatedAt, requestId}
+}
+
+// moveStatusIndexEntry moves a request's entry from its previous status to its current one. It runs after the
+// status change was applied, lightweight transactions cannot be batched with other partitions, so a failure
+// leaves a stale entry behind; listings check the current status of every entry they return.
+func (session ScyllaDbDaoImpl) moveStatusIndexEntry(ctx context.Context, smsDetails *models.SMSRequest, fromStatus models.SMSStatus, fromUpdatedAt time.Time) {
+	logger := utils.DatabaseLogger(ctx, "batch", "sms_by_status", smsDetails.ID)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "batch", "sms_by_status", time.Now())
+
+	batch := session.scyllaSession.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	if !fromUpdatedAt.IsZero() {
+		deleteStmt, deleteArgs := smsStatusIndexDelete(smsDetails.TenantID, fromStatus, fromUpdatedAt, smsDetails.ID)
+		batch.Query(deleteStmt, deleteArgs...)
+	}
+	insertStmt, insertArgs := smsStatusIndexInsert(smsDetails.TenantID, smsDetails.Status, smsDetails.UpdatedAt, smsDetails.ID)
+	batch.Query(insertStmt, insertArgs...)
+
+	err := session.scyllaSession.ExecuteBatch(batch)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("from_status", string(fromStatus)).
+			Str("new_status", string(smsDetails.Status)).
+			Msg("Failed to move SMS request in status index")
+	}
+}
+
+// GetSMSByStatus returns one page of at most limit entries of a status bucket changed at or after since,
+// newest first, and the paging state of the next page, nil on the last one.
+func (session ScyllaDbDaoImpl) GetSMSByStatus(ctx context.Context, tenantId string, status models.SMSStatus, bucket time.Time, since time.Time, limit int, pageState []byte) ([]models.SMSStatusEntry, []byte, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_by_status", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_by_status", time.Now())
+
+	iter := qb.Select("sms_by_status").
+		Columns(smsStatusIndexColumns...).
+		Where(qb.Eq("tenant_id"), qb.Eq("status"), qb.Eq("bucket"), qb.GtOrEqNamed("updated_at", "since")).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"tenant_id": tenantId, "status": status, "bucket": bucket, "since": since}).
+		PageSize(limit).
+		PageState(pageState).
+		Iter()
+
+	entries, nextPageState, err := scanPage[models.SMSStatusEntry](iter)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("status", string(status)).
+			Time("bucket", bucket).
+			Msg("Failed to retrieve SMS requests by status")
+		return nil, nil, err
+	}
+	return entries, nextPageState, nil
+}
+
+// GetSMSByStatusBefore returns up to limit entries of a status bucket that last changed at or before until, newest first.
+func (session ScyllaDbDaoImpl) GetSMSByStatusBefore(ctx context.Context, tenantId string, status models.SMSStatus, bucket time.Time, until time.Time, limit int) ([]models.SMSStatusEntry, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_by_status", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_by_status", time.Now())
+
+	var entries []models.SMSStatusEntry
+	err := qb.Select("sms_by_status").
+		Columns(smsStatusIndexColumns...).
+		Where(qb.Eq("tenant_id"), qb.Eq("status"), qb.Eq("bucket"), qb.LtOrEqNamed("updated_at", "until")).
+		Limit(uint(limit)).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"tenant_id": tenantId, "status": status, "bucket": bucket, "until": until}).
+		SelectRelease(&entries)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("status", string(status)).
+			Time("bucket", bucket).
+			Msg("Failed to retrieve SMS requests by status")
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteStatusIndexEntry removes a stale entry, one left behind by a status change whose index move failed.
+func (session ScyllaDbDaoImpl) DeleteStatusIndexEntry(ctx context.Context, entry models.SMSStatusEntry) error {
+	logger := utils.DatabaseLogger(ctx, "delete", "sms_by_status", entry.RequestId)
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "delete", "sms_by_status", time.Now())
+
+	query := qb.Delete("sms_by_status").
+		Where(qb.Eq("tenant_id"), qb.Eq("status"), qb.Eq("bucket"), qb.Eq("updated_at"), qb.Eq("request_id")).
+		QueryContext(ctx, *session.scyllaSession)
+
+	err := query.BindMap(qb.M{
+		"tenant_id":  entry.TenantID,
+		"status":     entry.Status,
+		"bucket":     entry.Bucket,
+		"updated_at": entry.UpdatedAt,
+		"request_id": entry.RequestId,
+	}).ExecRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("status", string(entry.Status)).
+			Msg("Failed to delete stale status index entry")
+		return err
+	}
+	return nil
+}
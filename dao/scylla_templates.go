@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// this file has the queries on sms_templates. a template is a partition, keyed by its tenant and id, and every
+// version a row, clustered newest first, so the latest version is simply the first row of the partition.
+// every read and delete names the tenant, a template of another tenant is not found.
+
+var smsTemplateColumns = []string{"tenant_id", "id", "version", "name", "body", "placeholders", "created_at"}
+
+// InsertTemplateVersion writes a new version only if that version does not exist yet.
+// It returns false when another writer created the same version first.
+func (session ScyllaDbDaoImpl) InsertTemplateVersion(ctx context.Context, template models.SMSTemplate) (bool, error) {
+	logger := utils.DatabaseLogger(ctx, "insert", "sms_templates", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "insert", "sms_templates", time.Now())
+
+	query := qb.Insert("sms_templates").
+		Columns(smsTemplateColumns...).
+		Unique().
+		QueryContext(ctx, *session.scyllaSession)
+
+	applied, err := query.BindStruct(template).ExecCASRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("tenant_id", template.TenantID).
+			Str("template_id", template.ID).
+			Int("version", template.Version).
+			Msg("Failed to insert template version")
+		return false, err
+	}
+
+	logger.Info().
+		Str("template_id", template.ID).
+		Int("version", template.Version).
+		Bool("applied", applied).
+		Msg("Inserted template version")
+	return applied, nil
+}
+
+// GetTemplate returns one version of a template, or the latest one when version is 0.
+func (session ScyllaDbDaoImpl) GetTemplate(ctx context.Context, tenantId string, templateId string, version int) (*models.SMSTemplate, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_templates", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_templates", time.Now())
+
+	var template models.SMSTemplate
+	builder := qb.Select("sms_templates").
+		Columns(smsTemplateColumns...).
+		Where(qb.Eq("tenant_id"), qb.Eq("id"))
+	bind := qb.M{"tenant_id": tenantId, "id": templateId}
+	if version > 0 {
+		builder = builder.Where(qb.Eq("version"))
+		bind["version"] = version
+	}
+
+	err := builder.Limit(1).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(bind).
+		GetRelease(&template)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("tenant_id", tenantId).
+			Str("template_id", templateId).
+			Int("version", version).
+			Msg("Failed to retrieve template")
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetTemplateVersions returns every version of a template, newest first.
+func (session ScyllaDbDaoImpl) GetTemplateVersions(ctx context.Context, tenantId string, templateId string) ([]models.SMSTemplate, error) {
+	logger := utils.DatabaseLogger(ctx, "select", "sms_templates", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_templates", time.Now())
+
+	var templates []models.SMSTemplate
+	err := qb.Select("sms_templates").
+		Columns(smsTemplateColumns...).
+		Where(qb.Eq("tenant_id"), qb.Eq("id")).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"tenant_id": tenantId, "id": templateId}).
+		SelectRelease(&templates)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("tenant_id", tenantId).
+			Str("template_id", templateId).
+			Msg("Failed to retrieve template versions")
+		return nil, err
+	}
+	return templates, nil
+}
+
+// DeleteTemplate removes a template with all its versions.
+func (session ScyllaDbDaoImpl) DeleteTemplate(ctx context.Context, tenantId string, templateId string) error {
+	logger := utils.DatabaseLogger(ctx, "delete", "sms_templates", "")
+	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "delete", "sms_templates", time.Now())
+
+	err := qb.Delete("sms_templates").
+		Where(qb.Eq("tenant_id"), qb.Eq("id")).
+		QueryContext(ctx, *session.scyllaSession).
+		BindMap(qb.M{"tenant_id": tenantId, "id": templateId}).
+		ExecRelease()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("tenant_id", tenantId).
+			Str("template_id", templateId).
+			Msg("Failed to delete template")
+		return err
+	}
+
+	logger.Info().
+		Str("tenant_id", tenantId).
+		Str("template_id", templateId).
+		Msg("Deleted template")
+	return nil
+}
@@ -0,0 +1,23 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+// DLRParser turns a provider's delivery receipt webhook into normalised receipts.
+// One webhook call may carry several receipts.
+type DLRParser interface {
+	Parse(header http.Header, body []byte) ([]models.DeliveryReceipt, error)
+}
+
+// dlrParsers maps the :provider path segment of the dlr webhook to its parser.
+var dlrParsers = map[string]DLRParser{
+	HTTP_PROVIDER_NAME: HttpDLRParser{},
+}
+
+func GetDLRParser(provider string) (DLRParser, bool) {
+	parser, ok := dlrParsers[provider]
+	return parser, ok
+}
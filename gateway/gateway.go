@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// SMSGateway is implemented by every sms provider adapter.
+// Send hands the message over to the provider and returns the id the provider
+// assigned to it, which is what we later use to match delivery receipts.
+type SMSGateway interface {
+	Name() string
+	Send(ctx context.Context, req *models.SMSRequest) (string, error)
+}
+
+// GatewayError is the typed error every adapter returns when a send fails,
+// so the service layer can record the provider's code and decide whether a retry makes sense.
+type GatewayError struct {
+	Provider  string
+	Code      string // provider error code, or the http status when the provider gave none
+	Message   string
+	Retryable bool // true for timeouts, 5xx and throttling, false when the provider rejected the message
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("%s gateway error %s: %s", e.Provider, e.Code, e.Message)
+}
+
+// AsGatewayError unwraps err into a *GatewayError, wrapping unknown errors as retryable ones.
+func AsGatewayError(provider string, err error) *GatewayError {
+	var gwErr *GatewayError
+	if errors.As(err, &gwErr) {
+		return gwErr
+	}
+	return &GatewayError{
+		Provider:  provider,
+		Code:      "UNKNOWN",
+		Message:   err.Error(),
+		Retryable: true,
+	}
+}
+
+var (
+	gatewayOnce     sync.Once
+	gatewayInstance SMSGateway
+)
+
+// NewSMSGateway builds the adapter selected by Gateway.Provider in the app config.
+func NewSMSGateway(appConfig *models.AppConfig) SMSGateway {
+	logger := utils.ComponentLogger("sms_gateway")
+
+	gatewayOnce.Do(func() {
+		switch appConfig.Gateway.Provider {
+		case "http", "":
+			gatewayInstance = NewHttpGateway(appConfig)
+		default:
+			logger.Fatal().
+				Str("provider", appConfig.Gateway.Provider).
+				Msg("Unknown sms gateway provider")
+		}
+
+		logger.Info().
+			Str("provider", gatewayInstance.Name()).
+			Msg("SMS gateway initialized successfully")
+	})
+	return gatewayInstance
+}
+
+func GetSMSGateway() SMSGateway {
+	return gatewayInstance
+}
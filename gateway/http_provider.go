@@ -0,0 +1,226 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+const HTTP_PROVIDER_NAME = "http"
+
+// httpSendRequest is the json body POSTed to the provider endpoint.
+type httpSendRequest struct {
+	To        string `json:"to"`
+	Message   string `json:"message"`
+	SenderId  string `json:"sender_id,omitempty"`
+	Reference string `json:"reference"` // our request id, echoed back in delivery receipts
+}
+
+// httpSendResponse is what we expect back from the provider, on success and on failure.
+type httpSendResponse struct {
+	MessageId    string `json:"message_id"`
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// HttpGatewayImpl is a generic adapter for providers exposing a json-over-http send api.
+type HttpGatewayImpl struct {
+	client     *http.Client
+	endpoint   string
+	authHeader string
+	authToken  string
+	senderId   string
+}
+
+func NewHttpGateway(appConfig *models.AppConfig) *HttpGatewayImpl {
+	cfg := appConfig.Gateway.Http
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	authHeader := cfg.AuthHeader
+	if authHeader == "" {
+		authHeader = "Authorization"
+	}
+
+	// a dedicated transport so the provider gets its own pool of keep-alive connections.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: timeout,
+	}
+
+	return &HttpGatewayImpl{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		endpoint:   cfg.Endpoint,
+		authHeader: authHeader,
+		authToken:  cfg.AuthToken,
+		senderId:   cfg.SenderId,
+	}
+}
+
+func (g *HttpGatewayImpl) Name() string {
+	return HTTP_PROVIDER_NAME
+}
+
+func (g *HttpGatewayImpl) Send(ctx context.Context, req *models.SMSRequest) (string, error) {
+	logger := utils.RequestLogger(ctx, "sms_gateway", "send")
+
+	// the tenant's sender id, when it has one, replaces the configured default.
+	senderId := req.SenderId
+	if senderId == "" {
+		senderId = g.senderId
+	}
+	body, err := json.Marshal(httpSendRequest{
+		To:        req.PhoneNumber,
+		Message:   req.Message,
+		SenderId:  senderId,
+		Reference: req.ID,
+	})
+	if err != nil {
+		return "", &GatewayError{Provider: g.Name(), Code: "MARSHAL_FAILED", Message: err.Error()}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", &GatewayError{Provider: g.Name(), Code: "BAD_REQUEST", Message: err.Error()}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if g.authToken != "" {
+		httpReq.Header.Set(g.authHeader, g.authToken)
+	}
+
+	logger.Debug().
+		Str("request_id", req.ID).
+		Str("endpoint", g.endpoint).
+		Msg("Calling sms provider")
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		code := "NETWORK_ERROR"
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			code = "TIMEOUT"
+		}
+		return "", &GatewayError{Provider: g.Name(), Code: code, Message: err.Error(), Retryable: true}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", &GatewayError{Provider: g.Name(), Code: "READ_FAILED", Message: err.Error(), Retryable: true}
+	}
+
+	var sendResp httpSendResponse
+	// a non-json body is fine for error statuses, we still want the status code recorded.
+	_ = json.Unmarshal(respBody, &sendResp)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		code := sendResp.ErrorCode
+		if code == "" {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		message := sendResp.ErrorMessage
+		if message == "" {
+			message = fmt.Sprintf("provider responded with status %d", resp.StatusCode)
+		}
+		return "", &GatewayError{
+			Provider:  g.Name(),
+			Code:      code,
+			Message:   message,
+			Retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		}
+	}
+
+	if sendResp.MessageId == "" {
+		return "", &GatewayError{Provider: g.Name(), Code: "INVALID_RESPONSE", Message: "provider response has no message_id"}
+	}
+
+	return sendResp.MessageId, nil
+}
+
+// httpDeliveryReceipt is one receipt as posted by the generic http provider.
+type httpDeliveryReceipt struct {
+	MessageId   string `json:"message_id"`
+	Status      string `json:"status"` // see httpFinalStatuses, intermediate states like ENROUTE are ignored
+	ErrorCode   string `json:"error_code"`
+	DeliveredAt int64  `json:"delivered_at"` // unix seconds
+}
+
+// httpFinalStatuses maps the generic http provider's final receipt states to ours. Every other state, e.g.
+// ACCEPTED, BUFFERED or ENROUTE, only says the message is still on its way and is skipped.
+var httpFinalStatuses = map[string]models.SMSStatus{
+	"DELIVERED":     models.SMS_STATUS_DELIVERED,
+	"UNDELIVERED":   models.SMS_STATUS_UNDELIVERED,
+	"UNDELIVERABLE": models.SMS_STATUS_UNDELIVERED,
+	"FAILED":        models.SMS_STATUS_UNDELIVERED,
+	"REJECTED":      models.SMS_STATUS_UNDELIVERED,
+	"EXPIRED":       models.SMS_STATUS_UNDELIVERED,
+	"DELETED":       models.SMS_STATUS_UNDELIVERED,
+}
+
+// HttpDLRParser parses the generic http provider's receipts, sent either as one object or an array.
+// Receipts in an intermediate state are left out of the result.
+type HttpDLRParser struct{}
+
+func (HttpDLRParser) Parse(header http.Header, body []byte) ([]models.DeliveryReceipt, error) {
+	var raw []httpDeliveryReceipt
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("invalid delivery receipt payload: %w", err)
+		}
+	} else {
+		var single httpDeliveryReceipt
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return nil, fmt.Errorf("invalid delivery receipt payload: %w", err)
+		}
+		raw = append(raw, single)
+	}
+
+	receipts := make([]models.DeliveryReceipt, 0, len(raw))
+	for _, r := range raw {
+		if r.MessageId == "" {
+			return nil, errors.New("delivery receipt is missing message_id")
+		}
+		status, final := httpFinalStatuses[strings.ToUpper(r.Status)]
+		if !final {
+			continue
+		}
+		receipt := models.DeliveryReceipt{
+			ProviderMessageId: r.MessageId,
+			Status:            status,
+			CarrierErrorCode:  r.ErrorCode,
+		}
+		// only a delivered message has a delivery time, the provider's or ours when it sent none.
+		if status == models.SMS_STATUS_DELIVERED {
+			receipt.DeliveredAt = time.Now()
+			if r.DeliveredAt > 0 {
+				receipt.DeliveredAt = time.Unix(r.DeliveredAt, 0)
+			}
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
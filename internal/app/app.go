@@ -1,28 +1,68 @@
 package app
 
 import (
+	"context"
+
+	"github.com/padam-meesho/NotificationService/channels"
 	"github.com/padam-meesho/NotificationService/config"
 	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/gateway"
+	"github.com/padam-meesho/NotificationService/internal/lifecycle"
 	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/outbox"
+	"github.com/padam-meesho/NotificationService/internal/reaper"
 	services "github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/scheduler"
 	"github.com/padam-meesho/NotificationService/internal/utils"
 	"github.com/padam-meesho/NotificationService/kafka"
 )
 
 // this shall be like the constructor function for the NewApp, which shall be called in the main.go.
+// it only connects the clients and registers the background components with the lifecycle manager,
+// they are started, in the order registered, by lifecycle.Run and stopped in reverse on shutdown.
 
 func NewApp(appConfig models.AppConfig) {
 	logger := utils.ComponentLogger("app")
 
 	logger.Info().Msg("Starting application initialization")
+	appLifecycle := lifecycle.NewLifecycle(&appConfig)
+
+	// Initialize tracing first, so every client below already sees the global tracer and propagator
+	logger.Info().Msg("Initializing tracing")
+	tracing := config.InitTracing(&appConfig)
+	appLifecycle.Append(lifecycle.Hook{
+		Name:   "tracing",
+		OnStop: tracing.Shutdown,
+	})
 
 	// Initialize ScyllaDB client
 	logger.Info().Msg("Initializing ScyllaDB")
-	config.InitScyllaSession(&appConfig)
+	scyllaSession := config.InitScyllaSession(&appConfig)
+	appLifecycle.Append(lifecycle.Hook{
+		Name: "scylla",
+		OnStop: func(ctx context.Context) error {
+			scyllaSession.Close()
+			return nil
+		},
+	})
 
 	// Initialize Redis client
 	logger.Info().Msg("Initializing Redis")
-	config.NewRedisCache(&appConfig)
+	redisCache := config.NewRedisCache(&appConfig)
+	appLifecycle.Append(lifecycle.Hook{
+		Name: "redis",
+		OnStop: func(ctx context.Context) error {
+			return redisCache.Close()
+		},
+	})
+
+	// Initialize SMS gateway
+	logger.Info().Msg("Initializing SMS gateway")
+	smsGateway := gateway.NewSMSGateway(&appConfig)
+
+	// Register the delivery channels, before the consumer starts routing payloads to them
+	logger.Info().Msg("Registering notification channels")
+	channels.RegisterChannel(channels.NewSmsChannel(smsGateway))
 
 	// Initialize Kafka client
 	logger.Info().Msg("Initializing Kafka client")
@@ -34,12 +74,11 @@ func NewApp(appConfig models.AppConfig) {
 	// Initialize Kafka DAO
 	logger.Info().Msg("Initializing Kafka DAO")
 	kafkaDao := kafka.NewKafkaDao(&appConfig)
-
-	// Start Kafka consumer in a separate goroutine
-	go func() {
-		logger.Info().Msg("Starting Kafka consumer in background")
-		kafkaDao.Consume()
-	}()
+	// the producer is flushed after the consumer and the scheduler stopped, they produce too.
+	appLifecycle.Append(lifecycle.Hook{
+		Name:   "kafka_producer",
+		OnStop: kafkaDao.Close,
+	})
 
 	// Initialize service instance with DAOs
 	logger.Info().Msg("Initializing notification service")
@@ -48,5 +87,58 @@ func NewApp(appConfig models.AppConfig) {
 		*dao.NewScyllaSessionDao(),
 	)
 
+	// Rewrite blacklist entries added before numbers were normalised, lookups only use E.164
+	logger.Info().Msg("Migrating blacklist to E.164")
+	err := services.GetNotificationServiceInstance().MigrateBlacklistService(context.Background(), appConfig.Sms.DefaultRegion)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to migrate blacklist, numbers stored in other formats are not matched")
+	}
+
+	// Relay stored requests from the outbox to kafka, stopped before the producer is flushed
+	outboxRelay := outbox.NewOutboxRelay(&appConfig, *dao.NewScyllaSessionDao(), *dao.NewRedisDao(), kafkaDao)
+	appLifecycle.Append(lifecycle.Hook{
+		Name: "outbox_relay",
+		OnStart: func(ctx context.Context) error {
+			outboxRelay.Start()
+			return nil
+		},
+		OnStop: outboxRelay.Stop,
+	})
+
+	// Consume once the notification service the messages are handed to exists
+	appLifecycle.Append(lifecycle.Hook{
+		Name: "kafka_consumer",
+		OnStart: func(ctx context.Context) error {
+			logger.Info().Msg("Starting Kafka consumer in background")
+			kafkaDao.Consume()
+			return nil
+		},
+		OnStop: kafkaDao.StopConsumers,
+	})
+
+	// Release scheduled SMS requests once they are due
+	smsScheduler := scheduler.NewSmsScheduler(&appConfig, *dao.NewScyllaSessionDao(), *dao.NewRedisDao())
+	appLifecycle.Append(lifecycle.Hook{
+		Name: "scheduler",
+		OnStart: func(ctx context.Context) error {
+			smsScheduler.Start()
+			return nil
+		},
+		OnStop: smsScheduler.Stop,
+	})
+
+	// Recover requests stuck in an intermediate status, on the replica holding the reaper lease
+	if appConfig.Reaper.Enabled {
+		stuckSMSReaper := reaper.NewStuckSMSReaper(&appConfig, *dao.NewRedisDao())
+		appLifecycle.Append(lifecycle.Hook{
+			Name: "reaper",
+			OnStart: func(ctx context.Context) error {
+				stuckSMSReaper.Start()
+				return nil
+			},
+			OnStop: stuckSMSReaper.Stop,
+		})
+	}
+
 	logger.Info().Msg("Application initialization completed successfully")
 }
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// apiKeyErrorStatus maps api key service errors to the http status the caller should see.
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrAPIKeyNotFound):
+		return 404
+	case errors.Is(err, repo.ErrInvalidAPIKeyChange):
+		return 400
+	case errors.Is(err, repo.ErrAPIKeyConflict):
+		return 409
+	default:
+		return 500
+	}
+}
+
+func CreateAPIKeyController(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+	logger.Info().Msgf("CreateAPIKeyController called")
+	var req models.CreateAPIKey
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid Request Body",
+		})
+		return
+	}
+	serviceInstance := repo.GetNotificationServiceInstance()
+	created, err := serviceInstance.CreateAPIKeyService(c, req)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(201, created)
+}
+
+func ListAPIKeysController(c *gin.Context) {
+	serviceInstance := repo.GetNotificationServiceInstance()
+	keys, err := serviceInstance.ListAPIKeysService(c)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"api_keys": keys})
+}
+
+func RotateAPIKeyController(c *gin.Context) {
+	serviceInstance := repo.GetNotificationServiceInstance()
+	rotated, err := serviceInstance.RotateAPIKeyService(c, c.Param("key_id"))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, rotated)
+}
+
+func RevokeAPIKeyController(c *gin.Context) {
+	serviceInstance := repo.GetNotificationServiceInstance()
+	revoked, err := serviceInstance.RevokeAPIKeyService(c, c.Param("key_id"))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"api_key": revoked})
+}
@@ -1,16 +1,30 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/gateway"
 	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/repo"
 	"github.com/padam-meesho/NotificationService/internal/utils"
-	"github.com/padam-meesho/NotificationService/kafka"
 )
 
+// normalizePhoneNumber brings a number from the request body to E.164, the only form numbers are stored,
+// blacklisted and capped in. field names the offending field in the error returned to the caller.
+func normalizePhoneNumber(field string, number string) (string, *models.FieldError) {
+	canonical, err := utils.NormalizePhoneNumber(number, config.GetAppConfig().Sms.DefaultRegion)
+	if err != nil {
+		return "", &models.FieldError{Field: field, Error: err.Error()}
+	}
+	return canonical, nil
+}
+
 // we generate a traceID for all the different requests we get.
 func SendSmsController(c *gin.Context) {
 	// now here we have to define the service function that does the working internally.
@@ -26,6 +40,15 @@ func SendSmsController(c *gin.Context) {
 		})
 		return
 	}
+	// a missing number is reported by the channel's validation.
+	if req.PhoneNumber != "" {
+		var fieldErr *models.FieldError
+		req.PhoneNumber, fieldErr = normalizePhoneNumber("phone_number", req.PhoneNumber)
+		if fieldErr != nil {
+			c.JSON(400, gin.H{"message": "Invalid Request Body", "errors": []models.FieldError{*fieldErr}})
+			return
+		}
+	}
 	serviceInstance := repo.GetNotificationServiceInstance()
 	// now since the validation is done, call the service.
 	// call the repo blacklisted method to check before pushing this.
@@ -43,46 +66,153 @@ func SendSmsController(c *gin.Context) {
 		return
 	}
 
-	reqId, err := serviceInstance.SendSMSService(c, req)
+	sendAt, err := repo.ResolveSendAt(req.SendAt)
 	if err != nil {
-		c.JSON(400, gin.H{"ERROR": err})
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	req.SendAt = nil
+	if !sendAt.IsZero() {
+		req.SendAt = &sendAt
+	}
+
+	reqId, segments, err := serviceInstance.SendSMSService(c, req)
+	var segmentErr *repo.SegmentLimitError
+	if errors.As(err, &segmentErr) {
+		c.JSON(400, gin.H{"message": err.Error(), "max_segments": segmentErr.MaxSegments, "segments": segmentErr.Segments})
+		return
+	}
+	if errors.Is(err, repo.ErrTemplateNotFound) {
+		c.JSON(404, gin.H{"ERROR": err.Error()})
+		return
+	}
+	// unknown channels and channel validation errors are the caller's.
+	if err != nil {
+		c.JSON(400, gin.H{"ERROR": err.Error()})
+		return
+	}
+
+	// scheduled messages are released to kafka by the scheduler once they are due.
+	if req.SendAt != nil {
+		c.JSON(202, gin.H{"request_id": reqId, "send_at": req.SendAt, "segments": segments, "message": "message scheduled successfully!"})
+		return
+	}
+
+	// the request was stored with its outbox entry, the outbox relay hands it to kafka, nothing is sent yet.
+	c.JSON(202, gin.H{"request_id": reqId, "segments": segments, "message": "message accepted for sending!"})
+}
+
+// DeliveryReceiptController ingests delivery receipts (DLRs) posted by sms providers.
+func DeliveryReceiptController(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+	provider := c.Param("provider")
+
+	parser, ok := gateway.GetDLRParser(provider)
+	if !ok {
+		c.JSON(404, gin.H{"message": fmt.Sprintf("unknown provider %s", provider)})
 		return
 	}
 
-	// Create SMS payload
-	smsPayload := models.SendSmsPayload{
-		MessageId: reqId,
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"message": "Invalid Request Body"})
+		return
 	}
 
-	// Marshal the SMS payload
-	smsPayloadBytes, err := json.Marshal(smsPayload)
+	receipts, err := parser.Parse(c.Request.Header, body)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to marshal SMS payload")
-		c.JSON(500, gin.H{"error": "Failed to process request"})
+		logger.Warn().Err(err).Str("provider", provider).Msg("Failed to parse delivery receipt")
+		c.JSON(400, gin.H{"message": err.Error()})
 		return
 	}
 
-	// Create Kafka payload
-	payload := models.KafkaPayload{
-		Type: "SMS_REQUEST",
-		Data: smsPayloadBytes,
+	serviceInstance := repo.GetNotificationServiceInstance()
+	unknown := []string{}
+	notSentYet := []string{}
+	for _, receipt := range receipts {
+		err := serviceInstance.HandleDeliveryReceipt(c.Request.Context(), provider, receipt)
+		if errors.Is(err, repo.ErrUnknownProviderMessage) {
+			unknown = append(unknown, receipt.ProviderMessageId)
+			continue
+		}
+		if errors.Is(err, repo.ErrReceiptBeforeSent) {
+			notSentYet = append(notSentYet, receipt.ProviderMessageId)
+			continue
+		}
+		if err != nil {
+			// a 5xx makes the provider redeliver the batch, applying a receipt twice is harmless.
+			c.JSON(500, gin.H{"error": "Failed to process delivery receipt"})
+			return
+		}
 	}
 
-	// Send to Kafka producer
-	kafkaInstance := kafka.GetKafkaDao()
-	if kafkaInstance == nil {
-		logger.Error().Msg("Kafka DAO not initialized")
-		c.JSON(500, gin.H{"error": "Failed to process request"})
+	if len(notSentYet) > 0 {
+		// the provider redelivers the batch, the receipts applied meanwhile are ignored the second time.
+		c.JSON(409, gin.H{"message": "sms request not marked sent yet, redeliver later", "pending_message_ids": notSentYet})
 		return
 	}
-	err = kafkaInstance.Produce(payload)
+	if len(receipts) > 0 && len(unknown) == len(receipts) {
+		c.JSON(404, gin.H{"message": "no matching sms request", "unknown_message_ids": unknown})
+		return
+	}
+	c.JSON(200, gin.H{"processed": len(receipts) - len(unknown), "unknown_message_ids": unknown})
+}
+
+// SendBulkSmsController accepts many messages in one call and reports the outcome per recipient.
+func SendBulkSmsController(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+	logger.Info().Msgf("SendBulkSmsController called")
+	var req models.SendSmsBulk
+	err := c.ShouldBindJSON(&req)
+	if err != nil || len(req.Messages) == 0 {
+		c.JSON(400, gin.H{
+			"message": "Invalid Request Body",
+		})
+		return
+	}
+
+	smsConfig := config.GetAppConfig().Sms
+	if smsConfig.BulkMaxMessages > 0 && len(req.Messages) > smsConfig.BulkMaxMessages {
+		c.JSON(400, gin.H{"message": fmt.Sprintf("at most %d messages are allowed per request", smsConfig.BulkMaxMessages)})
+		return
+	}
+
+	// malformed numbers fail the whole call, so the caller can fix them all at once.
+	var fieldErrs []models.FieldError
+	for i := range req.Messages {
+		if req.Messages[i].PhoneNumber == "" {
+			continue
+		}
+		var fieldErr *models.FieldError
+		req.Messages[i].PhoneNumber, fieldErr = normalizePhoneNumber(fmt.Sprintf("messages[%d].phone_number", i), req.Messages[i].PhoneNumber)
+		if fieldErr != nil {
+			fieldErrs = append(fieldErrs, *fieldErr)
+		}
+	}
+	if len(fieldErrs) > 0 {
+		c.JSON(400, gin.H{"message": "Invalid Request Body", "errors": fieldErrs})
+		return
+	}
+
+	// accepted requests are stored with their outbox entries, the outbox relay hands them to kafka.
+	serviceInstance := repo.GetNotificationServiceInstance()
+	results, err := serviceInstance.SendBulkSMSService(c, req.Messages)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to produce Kafka message")
-		c.JSON(500, gin.H{"error": "Failed to process request"})
+		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"request_id": reqId, "message": "message sent successfully!"})
+	acceptedCount := 0
+	for _, result := range results {
+		if result.Result == models.BULK_RESULT_ACCEPTED {
+			acceptedCount++
+		}
+	}
+	c.JSON(202, gin.H{
+		"accepted": acceptedCount,
+		"rejected": len(results) - acceptedCount,
+		"results":  results,
+	})
 }
 
 func GetSmsController(c *gin.Context) {
@@ -102,6 +232,11 @@ func GetSmsController(c *gin.Context) {
 	// and then return it from the handler.
 	serviceInstance := repo.GetNotificationServiceInstance()
 	resp, err := serviceInstance.GetSMSService(c, request_id)
+	// requests of other tenants are reported as missing too.
+	if errors.Is(err, repo.ErrSMSNotFound) {
+		c.JSON(404, gin.H{"ERROR": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(400, gin.H{"ERROR": err})
 		return
@@ -109,6 +244,117 @@ func GetSmsController(c *gin.Context) {
 	c.JSON(200, gin.H{"request_id": requestID, "message_details": resp})
 }
 
+// ListSmsController pages through the messages sent to a phone number, or the messages currently in a status.
+func ListSmsController(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+	logger.Info().Msgf("ListSmsController called")
+
+	phoneNumber := c.Query("phone_number")
+	if c.Query("status") != "" {
+		if phoneNumber != "" {
+			c.JSON(400, gin.H{"message": "filter by either phone_number or status, not both"})
+			return
+		}
+		listSmsByStatus(c)
+		return
+	}
+	if phoneNumber == "" {
+		c.JSON(400, gin.H{"message": "Invalid Request", "errors": []models.FieldError{{Field: "phone_number", Error: "phone_number or status is required"}}})
+		return
+	}
+	phoneNumber, fieldErr := normalizePhoneNumber("phone_number", phoneNumber)
+	if fieldErr != nil {
+		c.JSON(400, gin.H{"message": "Invalid Request", "errors": []models.FieldError{*fieldErr}})
+		return
+	}
+	from, fromErr := parseTimeQuery(c, "from")
+	to, toErr := parseTimeQuery(c, "to")
+	limit, limitErr := parseLimitQuery(c)
+	if fieldErrs := collectFieldErrors(fromErr, toErr, limitErr); len(fieldErrs) > 0 {
+		c.JSON(400, gin.H{"message": "Invalid Request", "errors": fieldErrs})
+		return
+	}
+
+	serviceInstance := repo.GetNotificationServiceInstance()
+	page, err := serviceInstance.GetSMSHistoryService(c, phoneNumber, from, to, limit, c.Query("cursor"))
+	if errors.Is(err, repo.ErrInvalidCursor) || errors.Is(err, repo.ErrInvalidTimeWindow) {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list SMS requests")
+		c.JSON(500, gin.H{"error": "Failed to list SMS requests"})
+		return
+	}
+	c.JSON(200, page)
+}
+
+// listSmsByStatus pages through the messages whose status last changed to status at or after since, most recent first.
+func listSmsByStatus(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+
+	var statusErr *models.FieldError
+	status, ok := models.ParseSMSStatus(c.Query("status"))
+	if !ok {
+		statusErr = &models.FieldError{Field: "status", Error: "unknown status"}
+	}
+	since, sinceErr := parseTimeQuery(c, "since")
+	limit, limitErr := parseLimitQuery(c)
+	if fieldErrs := collectFieldErrors(statusErr, sinceErr, limitErr); len(fieldErrs) > 0 {
+		c.JSON(400, gin.H{"message": "Invalid Request", "errors": fieldErrs})
+		return
+	}
+
+	serviceInstance := repo.GetNotificationServiceInstance()
+	page, err := serviceInstance.ListSMSByStatusService(c, status, since, limit, c.Query("cursor"))
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list SMS requests by status")
+		c.JSON(500, gin.H{"error": "Failed to list SMS requests"})
+		return
+	}
+	c.JSON(200, page)
+}
+
+// parseTimeQuery reads an optional RFC3339 query param, the zero time when it is not set.
+func parseTimeQuery(c *gin.Context, field string) (time.Time, *models.FieldError) {
+	value := c.Query(field)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, &models.FieldError{Field: field, Error: "must be an RFC3339 timestamp"}
+	}
+	return parsed, nil
+}
+
+// parseLimitQuery reads the optional page size, 0 when it is not set.
+func parseLimitQuery(c *gin.Context) (int, *models.FieldError) {
+	value := c.Query("limit")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, &models.FieldError{Field: "limit", Error: "must be a positive number"}
+	}
+	return limit, nil
+}
+
+func collectFieldErrors(fieldErrs ...*models.FieldError) []models.FieldError {
+	var collected []models.FieldError
+	for _, fieldErr := range fieldErrs {
+		if fieldErr != nil {
+			collected = append(collected, *fieldErr)
+		}
+	}
+	return collected
+}
+
 func GetBlacklistController(c *gin.Context) {
 	logger := utils.LogWithContext(c.Request.Context())
 	logger.Info().Msgf("")
@@ -132,6 +378,12 @@ func AddToBlacklistController(c *gin.Context) {
 		})
 		return
 	}
+	var fieldErr *models.FieldError
+	req.PhoneNumbers, fieldErr = normalizePhoneNumber("phone_numbers", req.PhoneNumbers)
+	if fieldErr != nil {
+		c.JSON(400, gin.H{"message": "Invalid Request Body", "errors": []models.FieldError{*fieldErr}})
+		return
+	}
 	serviceInstance := repo.GetNotificationServiceInstance()
 	// now since the validation is done, call the service.
 	err = serviceInstance.AddToBlacklistService(c, req)
@@ -146,8 +398,11 @@ func RemoveFromBlacklistController(c *gin.Context) {
 	logger := utils.LogWithContext(c.Request.Context())
 	logger.Info().Msgf("")
 	// use of path variable here too.
-	number := c.Param("number")
-	// number, _ = strconv.Atoi(number)
+	number, fieldErr := normalizePhoneNumber("number", c.Param("number"))
+	if fieldErr != nil {
+		c.JSON(400, gin.H{"message": "Invalid phone number", "errors": []models.FieldError{*fieldErr}})
+		return
+	}
 	serviceInstance := repo.GetNotificationServiceInstance()
 	resp, err := serviceInstance.RemoveFromBlacklistService(c, number)
 	if err != nil {
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// templateErrorStatus maps template service errors to the http status the caller should see.
+func templateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrTemplateNotFound):
+		return 404
+	case errors.Is(err, repo.ErrInvalidTemplate):
+		return 400
+	case errors.Is(err, repo.ErrTemplateConflict):
+		return 409
+	default:
+		return 500
+	}
+}
+
+func CreateTemplateController(c *gin.Context) {
+	logger := utils.LogWithContext(c.Request.Context())
+	logger.Info().Msgf("CreateTemplateController called")
+	var req models.CreateTemplate
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid Request Body",
+		})
+		return
+	}
+	serviceInstance := repo.GetNotificationServiceInstance()
+	template, err := serviceInstance.CreateTemplateService(c, req)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(201, gin.H{"template": template})
+}
+
+// GetTemplateController returns the latest version, or the one asked for with ?version=.
+func GetTemplateController(c *gin.Context) {
+	templateId := c.Param("template_id")
+	version := 0
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			c.JSON(400, gin.H{"message": "version must be a positive number"})
+			return
+		}
+		version = parsed
+	}
+	serviceInstance := repo.GetNotificationServiceInstance()
+	template, err := serviceInstance.GetTemplateService(c, templateId, version)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"template": template})
+}
+
+func GetTemplateVersionsController(c *gin.Context) {
+	templateId := c.Param("template_id")
+	serviceInstance := repo.GetNotificationServiceInstance()
+	templates, err := serviceInstance.GetTemplateVersionsService(c, templateId)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"versions": templates})
+}
+
+func UpdateTemplateController(c *gin.Context) {
+	templateId := c.Param("template_id")
+	var req models.UpdateTemplate
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid Request Body",
+		})
+		return
+	}
+	serviceInstance := repo.GetNotificationServiceInstance()
+	template, err := serviceInstance.UpdateTemplateService(c, templateId, req)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"template": template})
+}
+
+func DeleteTemplateController(c *gin.Context) {
+	templateId := c.Param("template_id")
+	serviceInstance := repo.GetNotificationServiceInstance()
+	err := serviceInstance.DeleteTemplateService(c, templateId)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"ERROR": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"Message": "template successfully deleted!"})
+}
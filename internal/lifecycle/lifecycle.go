@@ -0,0 +1,175 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// the lifecycle manager owns the order the long running parts of the service start and stop in.
+// Hooks start in the order they were appended and stop in reverse, so the api server stops taking
+// requests before the consumer stops, the producer is flushed after both, and the stores close last.
+
+// Hook is one component of the service, either function may be nil.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+type Lifecycle interface {
+	Append(hook Hook)
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Fail(err error)
+	Run() error
+}
+
+type LifecycleImpl struct {
+	mu              sync.Mutex
+	hooks           []Hook
+	started         int // hooks started so far, only these are stopped
+	failed          chan error
+	shutdownTimeout time.Duration
+}
+
+var (
+	lifecycleInstance *LifecycleImpl
+	lifecycleOnce     sync.Once
+)
+
+func NewLifecycle(appConfig *models.AppConfig) *LifecycleImpl {
+	lifecycleOnce.Do(func() {
+		shutdownTimeout := appConfig.Server.ShutdownTimeout
+		if shutdownTimeout <= 0 {
+			shutdownTimeout = 30 * time.Second
+		}
+		lifecycleInstance = &LifecycleImpl{
+			failed:          make(chan error, 1),
+			shutdownTimeout: shutdownTimeout,
+		}
+	})
+	return lifecycleInstance
+}
+
+func GetLifecycle() *LifecycleImpl {
+	return lifecycleInstance
+}
+
+// Append adds a hook, started after and stopped before every hook appended earlier.
+func (l *LifecycleImpl) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the start hooks in order. When one fails, the hooks already started are stopped again.
+func (l *LifecycleImpl) Start(ctx context.Context) error {
+	logger := utils.ComponentLogger("lifecycle")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if hook.OnStart != nil {
+			err := hook.OnStart(ctx)
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("hook", hook.Name).
+					Msg("Failed to start component, stopping the ones already started")
+				l.stopStarted(ctx)
+				return err
+			}
+		}
+		l.started++
+		logger.Info().
+			Str("hook", hook.Name).
+			Msg("Component started")
+	}
+	return nil
+}
+
+// Stop runs the stop hooks of the started components in reverse order. A failing hook does not keep
+// the ones after it from running, the errors of all of them are returned together.
+func (l *LifecycleImpl) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stopStarted(ctx)
+}
+
+func (l *LifecycleImpl) stopStarted(ctx context.Context) error {
+	logger := utils.ComponentLogger("lifecycle")
+
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.OnStop == nil {
+			continue
+		}
+		start := time.Now()
+		err := hook.OnStop(ctx)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("hook", hook.Name).
+				Dur("duration", time.Since(start)).
+				Msg("Failed to stop component cleanly")
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info().
+			Str("hook", hook.Name).
+			Dur("duration", time.Since(start)).
+			Msg("Component stopped")
+	}
+	return errors.Join(errs...)
+}
+
+// Fail reports that a running component broke down, e.g. the api server could not listen, and makes Run shut down.
+func (l *LifecycleImpl) Fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+		// a shutdown is already on its way.
+	}
+}
+
+// Run starts every hook, blocks until SIGINT/SIGTERM or a component failure, and then stops
+// everything within the shutdown timeout.
+func (l *LifecycleImpl) Run() error {
+	logger := utils.ComponentLogger("lifecycle")
+
+	err := l.Start(context.Background())
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var cause error
+	select {
+	case sig := <-signals:
+		logger.Info().
+			Str("signal", sig.String()).
+			Dur("shutdown_timeout", l.shutdownTimeout).
+			Msg("Received signal, shutting down")
+	case cause = <-l.failed:
+		logger.Error().
+			Err(cause).
+			Msg("Component failed, shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+	defer cancel()
+	return errors.Join(cause, l.Stop(ctx))
+}
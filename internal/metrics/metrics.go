@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// the prometheus collectors of the service, scraped from /metrics. They are recorded next to the
+// log lines of the same operation, so a metric and the logs explaining it share their labels.
+
+const NAMESPACE = "notification_service"
+
+// stores a dao operation can run against.
+const (
+	STORE_REDIS  = "redis"
+	STORE_SCYLLA = "scylla"
+)
+
+// outcomes of kafka produce and consume calls.
+const (
+	KAFKA_RESULT_OK            = "ok"
+	KAFKA_RESULT_ERROR         = "error"
+	KAFKA_RESULT_RETRIED       = "retried"
+	KAFKA_RESULT_DEAD_LETTERED = "dead_lettered"
+)
+
+// outcomes of a gateway send.
+const (
+	GATEWAY_OUTCOME_SENT   = "sent"
+	GATEWAY_OUTCOME_FAILED = "failed"
+)
+
+// outcomes of a stuck request reaper run.
+const (
+	REAPER_RESULT_OK      = "ok"
+	REAPER_RESULT_ERROR   = "error"
+	REAPER_RESULT_SKIPPED = "skipped" // another replica holds the reaper lease
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve an HTTP request, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	kafkaProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "kafka_messages_produced_total",
+		Help:      "Messages produced to kafka, by topic and result.",
+	}, []string{"topic", "result"})
+
+	kafkaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "kafka_messages_consumed_total",
+		Help:      "Messages consumed from kafka, by topic and result.",
+	}, []string{"topic", "result"})
+
+	kafkaConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages between the last consumed offset and the high watermark, by topic and partition.",
+	}, []string{"topic", "partition"})
+
+	databaseOpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "db_operation_duration_seconds",
+		Help:      "Time taken by a redis or scylla operation, by store, operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"store", "operation", "table"})
+
+	gatewaySends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "gateway_sends_total",
+		Help:      "Messages handed to a delivery provider, by provider, outcome and error code.",
+	}, []string{"provider", "outcome", "error_code"})
+
+	statusTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "sms_status_transitions_total",
+		Help:      "SMS request status changes, by previous and new status.",
+	}, []string{"from", "to"})
+
+	reaperStuckRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "reaper_stuck_requests",
+		Help:      "Stuck SMS requests found by the last reaper run, by status and the action applied.",
+	}, []string{"status", "action"})
+
+	reaperRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "reaper_runs_total",
+		Help:      "Stuck request reaper runs, by result.",
+	}, []string{"result"})
+)
+
+// ObserveHTTPRequest records a served request, route is the route template, not the raw path.
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+func IncKafkaProduced(topic, result string) {
+	kafkaProduced.WithLabelValues(topic, result).Inc()
+}
+
+// IncKafkaProducedBy records count messages of a produced batch with the same result.
+func IncKafkaProducedBy(topic, result string, count int) {
+	kafkaProduced.WithLabelValues(topic, result).Add(float64(count))
+}
+
+func IncKafkaConsumed(topic, result string) {
+	kafkaConsumed.WithLabelValues(topic, result).Inc()
+}
+
+func SetKafkaConsumerLag(topic string, partition int32, lag int64) {
+	kafkaConsumerLag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+// ObserveDatabaseOp records the latency of a dao operation that started at start, meant to be deferred:
+//
+//	defer metrics.ObserveDatabaseOp(metrics.STORE_SCYLLA, "select", "sms_requests", time.Now())
+func ObserveDatabaseOp(store, operation, table string, start time.Time) {
+	databaseOpDuration.WithLabelValues(store, operation, table).Observe(time.Since(start).Seconds())
+}
+
+// IncGatewaySend records a delivery attempt, errorCode is empty for accepted messages.
+func IncGatewaySend(provider, outcome, errorCode string) {
+	gatewaySends.WithLabelValues(provider, outcome, errorCode).Inc()
+}
+
+func IncStatusTransition(from, to string) {
+	statusTransitions.WithLabelValues(from, to).Inc()
+}
+
+func SetReaperStuckRequests(status, action string, count int) {
+	reaperStuckRequests.WithLabelValues(status, action).Set(float64(count))
+}
+
+func IncReaperRun(result string) {
+	reaperRuns.WithLabelValues(result).Inc()
+}
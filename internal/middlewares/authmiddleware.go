@@ -1,15 +1,75 @@
 package middlewares
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/lifecycle"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
 )
 
-func AuthCheck() gin.HandlerFunc {
-	// consume the auth header and check if it matches our needs. it should be set to "Bearer password123"
+// CLIENT_ID_KEY is the gin context key holding the id of the authenticated api client.
+const CLIENT_ID_KEY = "client_id"
+
+// CLIENT_IDENTITY_KEY is the gin context key holding the *models.ClientIdentity of the request.
+const CLIENT_IDENTITY_KEY = "client_identity"
+
+// BOOTSTRAP_CLIENT_ID identifies the bootstrap key from the config, which can only manage api keys.
+const BOOTSTRAP_CLIENT_ID = "bootstrap"
+
+// GetClientID returns the authenticated api client of the request.
+func GetClientID(c *gin.Context) string {
+	return c.GetString(CLIENT_ID_KEY)
+}
+
+// GetClientIdentity returns the authenticated caller of the request, nil before AuthCheck ran.
+func GetClientIdentity(c *gin.Context) *models.ClientIdentity {
+	identity, _ := c.Get(CLIENT_IDENTITY_KEY)
+	clientIdentity, _ := identity.(*models.ClientIdentity)
+	return clientIdentity
+}
+
+var (
+	errInvalidAPIKey = errors.New("invalid api key")
+	errExpiredAPIKey = errors.New("api key has expired")
+	errIPNotAllowed  = errors.New("api key is not allowed from this ip address")
+)
+
+func AuthCheck(appConfig *models.AppConfig) gin.HandlerFunc {
+	// the bearer token is either a managed api key (see the admin key apis), checked against its hash in redis,
+	// or, when jwt auth is enabled, a service jwt verified against the keys of the jwks file.
 	// only for middleware we shall use gin.HandlerFunc
+	redisDao := dao.NewRedisDao()
+	var keySet *JwksKeySet
+	if appConfig.Auth.Jwt.Enabled {
+		var err error
+		keySet, err = NewJwksKeySet(appConfig.Auth.Jwt.JwksFile, appConfig.Auth.Jwt.ReloadInterval)
+		if err != nil {
+			logger := utils.ComponentLogger("auth")
+			logger.Fatal().
+				Err(err).
+				Str("path", appConfig.Auth.Jwt.JwksFile).
+				Msg("Failed to load jwks file")
+		}
+		// the keys are reloaded while the api server runs, it is registered after this and stops first.
+		lifecycle.GetLifecycle().Append(lifecycle.Hook{
+			Name: "jwks_reload",
+			OnStart: func(ctx context.Context) error {
+				keySet.Start()
+				return nil
+			},
+			OnStop: keySet.Stop,
+		})
+	}
 	return func(c *gin.Context) {
+		logger := utils.LogWithContext(c.Request.Context())
 		token := c.GetHeader("Authorization")
 		if token == "" {
 			c.JSON(401, gin.H{
@@ -28,13 +88,133 @@ func AuthCheck() gin.HandlerFunc {
 			return
 		}
 
-		if parts[1] != "password123" {
+		var identity *models.ClientIdentity
+		var err error
+		if keySet != nil && looksLikeJWT(parts[1]) {
+			identity, err = authenticateJWT(keySet, parts[1], appConfig)
+		} else {
+			identity, err = authenticateAPIKey(c, redisDao, parts[1], appConfig.Auth.BootstrapKeyHash)
+		}
+		switch {
+		case errors.Is(err, errIPNotAllowed):
+			logger.Warn().Str("client_ip", c.ClientIP()).Msg("API key used from an address outside its allowlist")
+			c.JSON(403, gin.H{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		case errors.Is(err, errInvalidJWT):
+			logger.Warn().Err(err).Msg("Rejected jwt")
+			c.JSON(401, gin.H{
+				"error": "Unauthorized",
+			})
+			c.Abort()
+			return
+		case errors.Is(err, errInvalidAPIKey), errors.Is(err, errExpiredAPIKey):
 			c.JSON(401, gin.H{
 				"error": "Unauthorized",
 			})
 			c.Abort()
 			return
+		case err != nil:
+			logger.Error().Err(err).Msg("Failed to verify credentials")
+			c.JSON(503, gin.H{
+				"error": "Unable to verify credentials, please retry",
+			})
+			c.Abort()
+			return
 		}
+
+		c.Set(CLIENT_ID_KEY, identity.ClientID)
+		c.Set(CLIENT_IDENTITY_KEY, identity)
+		ctx := utils.WithClient(c.Request.Context(), identity.ClientID, identity.Owner)
+		c.Request = c.Request.WithContext(utils.WithTenant(ctx, identity.TenantID))
 		c.Next()
 	} // the middleware work is over now, it shall now pass it to the next one.
 }
+
+// authenticateAPIKey resolves a bearer token to the client it was issued to.
+func authenticateAPIKey(c *gin.Context, redisDao *dao.RedisDaoImpl, token string, bootstrapKeyHash string) (*models.ClientIdentity, error) {
+	if bootstrapKeyHash != "" && subtle.ConstantTimeCompare([]byte(utils.HashAPIKeySecret(token)), []byte(bootstrapKeyHash)) == 1 {
+		return &models.ClientIdentity{
+			ClientID: BOOTSTRAP_CLIENT_ID,
+			Owner:    BOOTSTRAP_CLIENT_ID,
+			TenantID: models.DEFAULT_TENANT,
+			Scopes:   []string{models.SCOPE_KEYS_ADMIN},
+		}, nil
+	}
+
+	keyId, secret, ok := utils.ParseAPIKey(token)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+	apiKey, secretHash, err := redisDao.GetAPIKey(c.Request.Context(), keyId)
+	if errors.Is(err, dao.ErrAPIKeyNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if secretHash == "" || apiKey.RevokedAt != nil ||
+		subtle.ConstantTimeCompare([]byte(utils.HashAPIKeySecret(secret)), []byte(secretHash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, errExpiredAPIKey
+	}
+	if !ipAllowed(c.ClientIP(), apiKey.IPAllowlist) {
+		return nil, errIPNotAllowed
+	}
+
+	tenantID := apiKey.TenantID
+	if tenantID == "" {
+		tenantID = models.DEFAULT_TENANT
+	}
+	return &models.ClientIdentity{
+		ClientID: apiKey.ID,
+		Owner:    apiKey.Owner,
+		TenantID: tenantID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+// ipAllowed reports whether ip matches one of the allowlist entries, an empty allowlist allows all.
+func ipAllowed(ip string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowlist {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed, err := netip.ParseAddr(entry); err == nil && allowed.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope lets the request through only if the authenticated client was granted scope,
+// through its api key or the roles of its jwt.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := GetClientIdentity(c)
+		if identity == nil || !identity.HasScope(scope) {
+			c.JSON(403, gin.H{
+				"error":               "Forbidden",
+				"required_permission": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
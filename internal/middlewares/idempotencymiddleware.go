@@ -0,0 +1,124 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+const IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+// responseRecorder keeps a copy of everything the handler writes, so it can be replayed later.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func IdempotencyCheck(ttl time.Duration) gin.HandlerFunc {
+	// requests carrying an Idempotency-Key are remembered per api client for ttl.
+	// a retry with the same key and body gets the original successful response back instead of a second send,
+	// the same key with a different body is a client bug and gets a 409.
+	redisDao := dao.NewRedisDao()
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(IDEMPOTENCY_KEY_HEADER)
+		if key == "" {
+			c.Next()
+			return
+		}
+		logger := utils.LogWithContext(c.Request.Context())
+
+		if len(key) > 255 {
+			c.JSON(400, gin.H{
+				"error": "Idempotency-Key must be at most 255 characters",
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid Request Body",
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		digest := sha256.Sum256(append([]byte(c.Request.Method+" "+c.FullPath()+"\n"), body...))
+		requestHash := hex.EncodeToString(digest[:])
+		redisKey := GetClientID(c) + ":" + key
+
+		existing, reserved, err := redisDao.ReserveIdempotencyKey(c.Request.Context(), redisKey, models.IdempotencyRecord{
+			RequestHash: requestHash,
+			State:       models.IDEMPOTENCY_STATE_IN_PROGRESS,
+		}, ttl)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to check idempotency key")
+			c.JSON(503, gin.H{
+				"error": "Unable to verify Idempotency-Key, please retry",
+			})
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			if existing.RequestHash != requestHash {
+				c.JSON(409, gin.H{
+					"error": "Idempotency-Key was already used with a different request",
+				})
+				c.Abort()
+				return
+			}
+			if existing.State != models.IDEMPOTENCY_STATE_COMPLETED {
+				c.JSON(409, gin.H{
+					"error": "A request with this Idempotency-Key is still being processed",
+				})
+				c.Abort()
+				return
+			}
+			logger.Info().Str("idempotency_key", key).Msg("Replaying response for repeated Idempotency-Key")
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(existing.StatusCode, "application/json; charset=utf-8", existing.Response)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+		c.Next()
+
+		// only a request that went through is remembered. Anything else, a validation error, a rejected
+		// number or a server error, releases the key, so the client can fix the request or retry it with the same key.
+		if c.Writer.Status() < 200 || c.Writer.Status() > 299 {
+			_ = redisDao.DeleteIdempotencyKey(c.Request.Context(), redisKey)
+			return
+		}
+		_ = redisDao.SaveIdempotencyRecord(c.Request.Context(), redisKey, models.IdempotencyRecord{
+			RequestHash: requestHash,
+			State:       models.IDEMPOTENCY_STATE_COMPLETED,
+			StatusCode:  c.Writer.Status(),
+			Response:    recorder.body.Bytes(),
+		}, ttl)
+	}
+}
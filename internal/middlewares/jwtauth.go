@@ -0,0 +1,267 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// service jwts are verified against the keys of a local jwks file, which is re-read periodically so
+// keys can be rolled without a restart. RSA keys verify RS256 tokens and symmetric (oct) keys HS256 ones,
+// a token is never checked with a key of the other kind.
+
+// jwk is one key of the jwks file, only the fields we need.
+type jwk struct {
+	Kty string `json:"kty"` // RSA or oct
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"` // RSA modulus
+	E   string `json:"e"` // RSA exponent
+	K   string `json:"k"` // symmetric key
+}
+
+type jwksFile struct {
+	Keys []jwk `json:"keys"`
+}
+
+// verificationKey is a parsed jwk with the signing method it is allowed to verify.
+type verificationKey struct {
+	method string
+	key    interface{}
+}
+
+type JwksKeySet struct {
+	path           string
+	reloadInterval time.Duration
+	keys           atomic.Pointer[map[string]verificationKey]
+	stop           chan struct{} // closed to end the reload loop
+	done           chan struct{} // closed once the reload loop has returned
+}
+
+// NewJwksKeySet loads the jwks file, Start keeps re-reading it every reloadInterval.
+func NewJwksKeySet(path string, reloadInterval time.Duration) (*JwksKeySet, error) {
+	if reloadInterval <= 0 {
+		reloadInterval = time.Minute
+	}
+	keySet := &JwksKeySet{
+		path:           path,
+		reloadInterval: reloadInterval,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if err := keySet.load(); err != nil {
+		return nil, err
+	}
+	return keySet, nil
+}
+
+// Start runs the reload loop in the background. A file that fails to load on a reload is logged
+// and the previous keys stay in use.
+func (k *JwksKeySet) Start() {
+	go func() {
+		defer close(k.done)
+		logger := utils.ComponentLogger("jwks")
+		ticker := time.NewTicker(k.reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-k.stop:
+				return
+			case <-ticker.C:
+				if err := k.load(); err != nil {
+					logger.Error().
+						Err(err).
+						Str("path", k.path).
+						Msg("Failed to reload jwks file, keeping the previous keys")
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the reload loop and waits for a reload in progress to finish.
+func (k *JwksKeySet) Stop(ctx context.Context) error {
+	close(k.stop)
+	select {
+	case <-k.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (k *JwksKeySet) load() error {
+	raw, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var file jwksFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("invalid jwks file: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(file.Keys))
+	for _, key := range file.Keys {
+		parsed, err := parseJwk(key)
+		if err != nil {
+			return fmt.Errorf("jwks key %q: %w", key.Kid, err)
+		}
+		keys[key.Kid] = parsed
+	}
+	k.keys.Store(&keys)
+
+	logger := utils.ComponentLogger("jwks")
+	logger.Debug().
+		Int("keys", len(keys)).
+		Msg("Loaded jwks file")
+	return nil
+}
+
+func parseJwk(key jwk) (verificationKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return verificationKey{
+			method: jwt.SigningMethodRS256.Alg(),
+			key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			},
+		}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(key.K)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid key: %w", err)
+		}
+		return verificationKey{method: jwt.SigningMethodHS256.Alg(), key: secret}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+// keyFunc picks the key named by the token's kid, a token without kid is accepted only when the set has a single key.
+func (k *JwksKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	keys := *k.keys.Load()
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys[kid]
+	if !ok && kid == "" && len(keys) == 1 {
+		for _, only := range keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method {
+		return nil, fmt.Errorf("signing key %q cannot verify %s tokens", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+var errInvalidJWT = errors.New("invalid jwt")
+
+// looksLikeJWT tells a jwt (header.payload.signature) from an api key (id.secret).
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// authenticateJWT verifies a service jwt and grants it the permissions of its roles.
+func authenticateJWT(keySet *JwksKeySet, token string, cfg *models.AppConfig) (*models.ClientIdentity, error) {
+	jwtConfig := cfg.Auth.Jwt
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if jwtConfig.Issuer != "" {
+		options = append(options, jwt.WithIssuer(jwtConfig.Issuer))
+	}
+	if jwtConfig.Audience != "" {
+		options = append(options, jwt.WithAudience(jwtConfig.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keySet.keyFunc, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidJWT, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", errInvalidJWT)
+	}
+	rolesClaim := jwtConfig.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	roles := claimStrings(claims[rolesClaim])
+	tenantClaim := jwtConfig.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = "tenant_id"
+	}
+	tenantID, _ := claims[tenantClaim].(string)
+	if tenantID == "" {
+		tenantID = models.DEFAULT_TENANT
+	}
+
+	return &models.ClientIdentity{
+		ClientID: "jwt:" + subject,
+		Owner:    subject,
+		TenantID: strings.ToLower(tenantID),
+		Roles:    roles,
+		Scopes:   permissionsForRoles(roles, cfg.Auth.RolePermissions),
+	}, nil
+}
+
+// claimStrings reads a claim holding either a list of strings or a space separated string.
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// permissionsForRoles is the union of the permissions of every role, roles without a mapping grant nothing.
+func permissionsForRoles(roles []string, rolePermissions map[string][]string) []string {
+	seen := map[string]bool{}
+	permissions := []string{}
+	for _, role := range roles {
+		// role names come from the config, whose keys are lowercase.
+		for _, permission := range rolePermissions[strings.ToLower(role)] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
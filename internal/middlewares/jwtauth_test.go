@@ -0,0 +1,157 @@
+package middlewares
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+var testSigningSecret = []byte("a-test-secret-of-thirty-two-bytes")
+
+// newTestKeySet writes a jwks file holding one HS256 key and loads it.
+func newTestKeySet(t *testing.T) *JwksKeySet {
+	t.Helper()
+	file, err := json.Marshal(jwksFile{Keys: []jwk{{
+		Kty: "oct",
+		Kid: "test",
+		K:   base64.RawURLEncoding.EncodeToString(testSigningSecret),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := NewJwksKeySet(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJwksKeySet() error = %v", err)
+	}
+	return keySet
+}
+
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(testSigningSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testJwtConfig() *models.AppConfig {
+	cfg := &models.AppConfig{}
+	cfg.Auth.RolePermissions = map[string][]string{
+		"sender":  {models.SCOPE_SMS_SEND, models.SCOPE_SMS_READ},
+		"support": {models.SCOPE_SMS_READ, models.SCOPE_BLACKLIST_READ},
+	}
+	return cfg
+}
+
+func TestPermissionsForRoles(t *testing.T) {
+	rolePermissions := testJwtConfig().Auth.RolePermissions
+
+	got := permissionsForRoles([]string{"Sender", "support", "auditor"}, rolePermissions)
+	want := []string{models.SCOPE_SMS_SEND, models.SCOPE_SMS_READ, models.SCOPE_BLACKLIST_READ}
+	if !slices.Equal(got, want) {
+		t.Errorf("permissionsForRoles() = %q, want %q, each permission once", got, want)
+	}
+
+	if got := permissionsForRoles([]string{"auditor"}, rolePermissions); len(got) != 0 {
+		t.Errorf("permissionsForRoles() of an unmapped role = %q, want none", got)
+	}
+}
+
+func TestAuthenticateJWTMapsRolesToScopes(t *testing.T) {
+	keySet := newTestKeySet(t)
+	token := signTestToken(t, jwt.MapClaims{
+		"sub":       "billing-service",
+		"roles":     "sender auditor",
+		"tenant_id": "Acme",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	})
+
+	identity, err := authenticateJWT(keySet, token, testJwtConfig())
+	if err != nil {
+		t.Fatalf("authenticateJWT() error = %v", err)
+	}
+	if identity.ClientID != "jwt:billing-service" || identity.Owner != "billing-service" {
+		t.Errorf("client = %q owned by %q, want jwt:billing-service owned by billing-service", identity.ClientID, identity.Owner)
+	}
+	if identity.TenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", identity.TenantID)
+	}
+	if !identity.HasScope(models.SCOPE_SMS_SEND) || identity.HasScope(models.SCOPE_BLACKLIST_READ) {
+		t.Errorf("scopes = %q, want the permissions of the sender role only", identity.Scopes)
+	}
+}
+
+func TestAuthenticateJWTRejectsInvalidTokens(t *testing.T) {
+	keySet := newTestKeySet(t)
+	cfg := testJwtConfig()
+	tokens := map[string]string{
+		"expired":  signTestToken(t, jwt.MapClaims{"sub": "billing-service", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no exp":   signTestToken(t, jwt.MapClaims{"sub": "billing-service"}),
+		"no sub":   signTestToken(t, jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}),
+		"tampered": signTestToken(t, jwt.MapClaims{"sub": "billing-service", "exp": time.Now().Add(time.Minute).Unix()}) + "x",
+	}
+
+	for name, token := range tokens {
+		if _, err := authenticateJWT(keySet, token, cfg); !errors.Is(err, errInvalidJWT) {
+			t.Errorf("%s: authenticateJWT() error = %v, want errInvalidJWT", name, err)
+		}
+	}
+}
+
+// serveWithIdentity runs RequireScope(scope) for a caller authenticated as identity, nil for none.
+func serveWithIdentity(identity *models.ClientIdentity, scope string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/blacklist", func(c *gin.Context) {
+		if identity != nil {
+			c.Set(CLIENT_IDENTITY_KEY, identity)
+		}
+	}, RequireScope(scope), func(c *gin.Context) {
+		c.JSON(200, gin.H{"data": []string{}})
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/blacklist", nil))
+	return recorder
+}
+
+func TestRequireScope(t *testing.T) {
+	support := &models.ClientIdentity{ClientID: "jwt:support-tool", Scopes: []string{models.SCOPE_SMS_READ, models.SCOPE_BLACKLIST_READ}}
+
+	if recorder := serveWithIdentity(support, models.SCOPE_BLACKLIST_READ); recorder.Code != 200 {
+		t.Errorf("status with the scope = %d, want 200", recorder.Code)
+	}
+
+	for name, identity := range map[string]*models.ClientIdentity{"without the scope": support, "unauthenticated": nil} {
+		recorder := serveWithIdentity(identity, models.SCOPE_BLACKLIST_WRITE)
+		if recorder.Code != 403 {
+			t.Errorf("%s: status = %d, want 403", name, recorder.Code)
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: invalid response body %q: %v", name, recorder.Body.String(), err)
+		}
+		if body["error"] != "Forbidden" || body["required_permission"] != models.SCOPE_BLACKLIST_WRITE {
+			t.Errorf("%s: body = %v, want Forbidden naming %s", name, body, models.SCOPE_BLACKLIST_WRITE)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners hitting random paths cannot blow up the label set.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware counts every request and its latency per route template.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
@@ -1,31 +1,46 @@
 package middlewares
 
 import (
-	"context"
+	"fmt"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type contextKey string // this is a custom data type we have created.
-
-const traceIDKey contextKey = "trace_id"
+const TRACER_NAME = "github.com/padam-meesho/NotificationService/http"
 
 func TraceMiddleware() gin.HandlerFunc {
-	// this middleware simply generates a new trace id for each incoming request
-	// and adds it via a header to our request
+	// this middleware continues the trace of an incoming W3C traceparent header, or starts a new one,
+	// and opens the server span of the request. utils.GetTraceID reads the trace id off that span,
+	// so every log line of the request carries it, and kafka produce calls hand it on to the consumer.
+	tracer := otel.Tracer(TRACER_NAME)
 	return func(c *gin.Context) {
-		traceID := uuid.New().String()
-		c.Header("X-Trace-Id", traceID)
-
-		ctx := context.WithValue(c.Request.Context(), traceIDKey, traceID)
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+			))
+		defer span.End()
+
+		c.Header("X-Trace-Id", span.SpanContext().TraceID().String())
 		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
 	}
 }
-
-// what is the need for the custom data type or the use of ContextKeys?
-// understand this, we can have multiple functions which want to write with the same header name to the request
-// so what we do is create a custom type for it, how that helps?
-// middlewares.contextKey["traceId"]!=logger.contextKey["traceId"]
@@ -1,10 +1,31 @@
 package models
 
+import "time"
+
 type AppConfig struct {
+	Server struct {
+		Addr            string        // address the api server listens on, defaults to ":3333"
+		DrainTimeout    time.Duration // how long in-flight api requests get to finish on shutdown
+		ShutdownTimeout time.Duration // how long the whole shutdown may take, draining included
+	}
 	Kafka struct {
 		BootStrapServers string // bootstrap.servers
 		GroupId          string // "group.id"
 		AutoOffsetReset  string // "auto.offset.reset"
+		Consumer         struct {
+			Workers        int           // messages of a topic processed at the same time, each recipient's messages by one worker in order
+			MaxInFlight    int           // messages read but not done per topic before reading pauses
+			CommitInterval time.Duration // how often the offsets of done messages are committed
+			RevokeTimeout  time.Duration // how long a rebalance waits for the messages in hand of revoked partitions
+		}
+		Producer struct {
+			DeliveryTimeout time.Duration // how long a message may take to be acknowledged before it counts as failed
+		}
+		Retry struct {
+			MaxAttempts int              // total processing attempts, including the first one, before a message is dead-lettered
+			Tiers       []KafkaRetryTier // retry topics in the order they are used, the last tier is reused once exhausted
+			DlqTopic    string           // topic a message is parked on after its last failed attempt
+		}
 	}
 	Redis struct {
 		Addr string // redis addr
@@ -15,4 +36,113 @@ type AppConfig struct {
 		Hosts    string // scylla hosts
 		Keyspace string // scylla keyspace
 	}
+	Sms struct {
+		BulkMaxMessages int           // most recipients accepted by a single bulk send call
+		BulkBatchSize   int           // bulk requests prepared and stored per chunk, each written in its own logged batch
+		IdempotencyTtl  time.Duration // how long an Idempotency-Key and its response are remembered
+		DefaultRegion   string        // ISO 3166 region of phone numbers sent without a country code, e.g. "IN"
+		MaxSegments     int           // most sms parts a single message may be split into, 0 for no limit
+		StatusIndexTtl  time.Duration // how long a request stays listable by status after its last change, 0 to keep forever
+	}
+	Auth struct {
+		BootstrapKeyHash string // sha256 hex of a key that may only manage api keys, used to create the first ones
+		Jwt              struct {
+			Enabled        bool
+			JwksFile       string        // local jwks file with the RS256 and HS256 verification keys
+			ReloadInterval time.Duration // how often the jwks file is re-read
+			Issuer         string        // required iss claim, not checked when empty
+			Audience       string        // required aud claim, not checked when empty
+			RolesClaim     string        // claim holding the caller's roles, defaults to "roles"
+			TenantClaim    string        // claim holding the caller's tenant, defaults to "tenant_id"
+		}
+		RolePermissions map[string][]string // permissions (scopes) granted by each jwt role, keys are lowercase
+	}
+	Tenants   map[string]TenantConfig // per tenant settings, keyed by lowercase tenant id
+	RateLimit struct {
+		Groups map[string]RateLimitRule // per route group (send, read, templates, blacklist), a missing group is not limited
+	}
+	FrequencyCaps struct {
+		Enabled    bool
+		Default    []FrequencyLimit            // limits for messages without a category, or with one not listed below
+		Categories map[string][]FrequencyLimit // limits per message category, keys are lowercase
+	}
+	Scheduler struct {
+		TickInterval     time.Duration // how often due scheduled messages are released
+		BucketSize       time.Duration // width of a scheduled_sms partition, must never change once data exists
+		LeaseTtl         time.Duration // how long a replica keeps a bucket without renewing its lease
+		MaxLookback      time.Duration // how far back the very first run looks for unreleased buckets
+		MaxScheduleAhead time.Duration // furthest in the future a send_at may be
+	}
+	Reaper struct {
+		Enabled   bool
+		Interval  time.Duration           // how often the leader looks for stuck requests
+		LeaseTtl  time.Duration           // how long the leader keeps the role without renewing it
+		BatchSize int                     // most stuck requests handled per status and run
+		Lookback  time.Duration           // how far past its threshold a request is still looked for, defaults to sms.statusIndexTtl
+		Policies  map[string]ReaperPolicy // what to do with requests stuck in a status, keyed by lowercase status
+	}
+	Outbox struct {
+		Shards       int           // sms_outbox partitions the relay replicas share out, may grow but never shrink once data exists
+		PollInterval time.Duration // how often the relay looks for new entries
+		BatchSize    int           // entries read and produced together
+		LeaseTtl     time.Duration // how long a replica keeps a shard without renewing its lease
+	}
+	Tracing struct {
+		Enabled      bool    // export spans over OTLP, trace ids are propagated and logged either way
+		OtlpEndpoint string  // host:port of the OTLP/HTTP collector, e.g. "localhost:4318"
+		Insecure     bool    // plain http to the collector
+		ServiceName  string  // service.name of the exported spans, defaults to "notification-service"
+		SampleRatio  float64 // share of new traces that are sampled, defaults to 1; incoming sampled traces are always kept
+	}
+	Gateway struct {
+		Provider string // name of the sms provider adapter to use, e.g. "http"
+		Http     struct {
+			Endpoint            string        // url the send request is POSTed to
+			AuthHeader          string        // header carrying the credentials, defaults to "Authorization"
+			AuthToken           string        // value set on the auth header
+			SenderId            string        // default sender id sent with every message
+			Timeout             time.Duration // overall timeout for one send call
+			MaxIdleConns        int           // connection pool size across all hosts
+			MaxIdleConnsPerHost int           // connection pool size for the provider host
+			IdleConnTimeout     time.Duration // how long an idle pooled connection is kept
+		}
+	}
+}
+
+// TenantConfig overrides defaults for one tenant.
+type TenantConfig struct {
+	SenderId  string                   // default sender id of the tenant's messages
+	RateLimit map[string]RateLimitRule // replaces the rateLimit rule of a route group for the tenant's clients
+}
+
+// RateLimitRule is a token bucket per api client: Limit requests per Period on average,
+// with bursts of up to Burst requests (defaults to Limit).
+type RateLimitRule struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// FrequencyLimit allows at most Limit messages to one recipient within any Window.
+type FrequencyLimit struct {
+	Window time.Duration
+	Limit  int
+}
+
+// actions the reaper can take on a stuck request.
+const (
+	REAPER_ACTION_REQUEUE = "requeue" // produce the request to kafka again, for Pending and Queued only
+	REAPER_ACTION_FAIL    = "fail"    // mark the request Failed
+	REAPER_ACTION_ALERT   = "alert"   // only log and count it
+)
+
+// ReaperPolicy applies Action to requests that have been in a status for longer than After.
+type ReaperPolicy struct {
+	After  time.Duration
+	Action string
+}
+
+type KafkaRetryTier struct {
+	Topic string        // e.g. "notification.send_sms.retry.1m"
+	Delay time.Duration // how long a message waits on this topic before being retried
 }
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// scopes an api key can be granted, every route requires one of them.
+// jwt callers get them through their roles, see Auth.RolePermissions in the config.
+const (
+	SCOPE_SMS_SEND         = "sms:send"
+	SCOPE_SMS_READ         = "sms:read"
+	SCOPE_TEMPLATES_WRITE  = "templates:write"
+	SCOPE_BLACKLIST_READ   = "blacklist:read"
+	SCOPE_BLACKLIST_WRITE  = "blacklist:write"
+	SCOPE_BLACKLIST_DELETE = "blacklist:delete"
+	SCOPE_DLR_WRITE        = "dlr:write" // for sms providers posting delivery receipts
+	SCOPE_KEYS_ADMIN       = "keys:admin"
+)
+
+// DEFAULT_TENANT owns rows written before tenants existed, and is the tenant of jwts without a tenant claim.
+const DEFAULT_TENANT = "default"
+
+var ALL_SCOPES = []string{
+	SCOPE_SMS_SEND,
+	SCOPE_SMS_READ,
+	SCOPE_TEMPLATES_WRITE,
+	SCOPE_BLACKLIST_READ,
+	SCOPE_BLACKLIST_WRITE,
+	SCOPE_BLACKLIST_DELETE,
+	SCOPE_DLR_WRITE,
+	SCOPE_KEYS_ADMIN,
+}
+
+// APIKey is a managed api key. Only a hash of its secret is stored, the secret itself is
+// shown once, when the key is created or rotated.
+type APIKey struct {
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner"`     // team or service the key was issued to
+	TenantID    string     `json:"tenant_id"` // tenant whose messages the key sends and reads
+	Scopes      []string   `json:"scopes"`
+	IPAllowlist []string   `json:"ip_allowlist,omitempty"` // ips or cidrs, empty allows every address
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // nil for a key that never expires
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ClientIdentity is the authenticated caller of a request, set by the auth middleware.
+type ClientIdentity struct {
+	ClientID string   `json:"client_id"` // api key id, or jwt:<sub> for jwt callers
+	Owner    string   `json:"owner"`
+	TenantID string   `json:"tenant_id"`
+	Roles    []string `json:"roles,omitempty"` // roles claim of a jwt caller
+	Scopes   []string `json:"scopes"`
+}
+
+func (i *ClientIdentity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
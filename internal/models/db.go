@@ -3,12 +3,90 @@ package models
 import "time"
 
 type SMSRequest struct {
-	ID              string    `json:"id" cql:"id"`
-	PhoneNumber     string    `json:"phone_number" cql:"phone_number"`
-	Message         string    `json:"message" cql:"message"`
-	Status          string    `json:"status" cql:"status"` // this can have "success", "failed", "pending values"
-	FailureCode     string    `json:"failure_code" cql:"failure_code"`
-	FailureComments string    `json:"failure_comments" cql:"failure_comments"`
-	CreatedAt       time.Time `json:"created_at" cql:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" cql:"updated_at"`
+	ID                string    `json:"id" cql:"id"`
+	TenantID          string    `json:"tenant_id" cql:"tenant_id"` // empty on rows written before tenants existed, meaning the default tenant
+	SenderId          string    `json:"sender_id" cql:"sender_id"` // sender id to send with, empty for the gateway's default
+	Channel           string    `json:"channel" cql:"channel"`     // empty on rows written before channels existed, meaning sms
+	PhoneNumber       string    `json:"phone_number" cql:"phone_number"`
+	Category          string    `json:"category" cql:"category"` // message category the frequency caps are picked by
+	Message           string    `json:"message" cql:"message"`
+	Encoding          string    `json:"encoding" cql:"encoding"`           // GSM-7 or UCS-2, empty on rows written before it was recorded
+	SegmentCount      int       `json:"segment_count" cql:"segment_count"` // billable sms parts of the message
+	Status            SMSStatus `json:"status" cql:"status"`               // see status.go for the allowed values and transitions
+	FailureCode       string    `json:"failure_code" cql:"failure_code"`
+	FailureComments   string    `json:"failure_comments" cql:"failure_comments"`
+	Provider          string    `json:"provider" cql:"provider"`                       // sms gateway the message was handed to
+	ProviderMessageId string    `json:"provider_message_id" cql:"provider_message_id"` // id assigned by the gateway
+	CarrierErrorCode  string    `json:"carrier_error_code" cql:"carrier_error_code"`   // error code from the delivery receipt
+	DeliveredAt       time.Time `json:"delivered_at" cql:"delivered_at"`               // when the carrier delivered the message
+	TemplateID        string    `json:"template_id,omitempty" cql:"template_id"`       // template the message was rendered from, if any
+	TemplateVersion   int       `json:"template_version,omitempty" cql:"template_version"`
+	SendAt            time.Time `json:"send_at" cql:"send_at"`                 // set for scheduled messages
+	Attempts          int       `json:"attempts" cql:"attempts"`               // number of times the consumer has processed this request
+	KafkaPartition    int32     `json:"kafka_partition" cql:"kafka_partition"` // where the broker stored the request's message, set once it acknowledged it
+	KafkaOffset       int64     `json:"kafka_offset" cql:"kafka_offset"`
+	CreatedAt         time.Time `json:"created_at" cql:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" cql:"updated_at"`
+}
+
+// SMSHistoryEntry is a row of sms_by_phone, the index of a tenant's requests to one recipient, newest first.
+type SMSHistoryEntry struct {
+	TenantID    string    `json:"tenant_id" cql:"tenant_id"`
+	PhoneNumber string    `json:"phone_number" cql:"phone_number"`
+	CreatedAt   time.Time `json:"created_at" cql:"created_at"`
+	RequestId   string    `json:"request_id" cql:"request_id"`
+}
+
+// SMSStatusEntry is a row of sms_by_status, the index of a tenant's requests currently in a status,
+// partitioned by day of their last status change.
+type SMSStatusEntry struct {
+	TenantID  string    `json:"tenant_id" cql:"tenant_id"`
+	Status    SMSStatus `json:"status" cql:"status"`
+	Bucket    time.Time `json:"bucket" cql:"bucket"` // updated_at truncated to the day
+	UpdatedAt time.Time `json:"updated_at" cql:"updated_at"`
+	RequestId string    `json:"request_id" cql:"request_id"`
+}
+
+// ScheduledSMS is a row of scheduled_sms, the time-bucketed index of messages waiting for their send_at.
+type ScheduledSMS struct {
+	Bucket       time.Time         `json:"bucket" cql:"bucket"` // send_at truncated to the scheduler bucket size
+	SendAt       time.Time         `json:"send_at" cql:"send_at"`
+	RequestId    string            `json:"request_id" cql:"request_id"`
+	TraceContext map[string]string `json:"trace_context" cql:"trace_context"` // W3C trace context of the api call, carried on to the outbox entry
+}
+
+// OutboxEntry is a row of sms_outbox, a request written to the database but not yet acknowledged by kafka.
+type OutboxEntry struct {
+	Shard        int               `json:"shard" cql:"shard"` // hash of the request id, the relay leases shards
+	CreatedAt    time.Time         `json:"created_at" cql:"created_at"`
+	RequestId    string            `json:"request_id" cql:"request_id"`
+	TenantID     string            `json:"tenant_id" cql:"tenant_id"`
+	Channel      string            `json:"channel" cql:"channel"`
+	PhoneNumber  string            `json:"phone_number" cql:"phone_number"`   // key of the kafka message, empty for entries written before messages were keyed
+	TraceContext map[string]string `json:"trace_context" cql:"trace_context"` // W3C trace context of the api call, carried on to the kafka message
+}
+
+// IdempotencyRecord is what redis keeps per Idempotency-Key: a digest of the first request and,
+// once it completed, the response to replay for its retries.
+type IdempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	State       string `json:"state"` // in_progress or completed
+	StatusCode  int    `json:"status_code,omitempty"`
+	Response    []byte `json:"response,omitempty"`
+}
+
+const (
+	IDEMPOTENCY_STATE_IN_PROGRESS = "in_progress"
+	IDEMPOTENCY_STATE_COMPLETED   = "completed"
+)
+
+// SMSTemplate is one version of a message template. Versions are immutable, an update adds a new one.
+type SMSTemplate struct {
+	TenantID     string    `json:"tenant_id" cql:"tenant_id"` // tenant owning the template, only its callers can see and use it
+	ID           string    `json:"id" cql:"id"`
+	Version      int       `json:"version" cql:"version"`
+	Name         string    `json:"name" cql:"name"`
+	Body         string    `json:"body" cql:"body"`
+	Placeholders []string  `json:"placeholders" cql:"placeholders"`
+	CreatedAt    time.Time `json:"created_at" cql:"created_at"`
 }
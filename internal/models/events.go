@@ -1,12 +1,28 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type SendSmsPayload struct {
 	MessageId string `json:"message_id"` // this shall be a unique uuid
 }
 
 type KafkaPayload struct {
-	Type string          `json:"type"` // this tells us which type of payload is being consumed.
-	Data json.RawMessage `json:"data"` // this shall be further consumed
+	Type     string          `json:"type"`      // this tells us which type of payload is being consumed.
+	TenantID string          `json:"tenant_id"` // tenant the request belongs to, carried into the consumer's logs
+	Data     json.RawMessage `json:"data"`      // this shall be further consumed
+
+	RequestId    string            `json:"-"` // request the payload is about, not sent; its row is marked Queued once the broker acknowledges the message
+	Key          string            `json:"-"` // message key, the recipient's phone number, so one recipient's messages share a partition and stay in order
+	TraceContext map[string]string `json:"-"` // trace to produce the message under instead of the caller's, e.g. of the api call an outbox entry was written by
+}
+
+// DeliveryReceipt is a provider delivery report (DLR) normalised by the provider's parser.
+type DeliveryReceipt struct {
+	ProviderMessageId string    `json:"provider_message_id"`
+	Status            SMSStatus `json:"status"` // Delivered or Undelivered
+	CarrierErrorCode  string    `json:"carrier_error_code,omitempty"`
+	DeliveredAt       time.Time `json:"delivered_at"` // zero unless Delivered
 }
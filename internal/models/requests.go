@@ -1,8 +1,20 @@
 package models
 
+import "time"
+
 type SendSms struct {
-	PhoneNumber string `json:"phone_number"`
-	Message     string `json:"message"`
+	Channel         string            `json:"channel,omitempty"` // defaults to sms
+	PhoneNumber     string            `json:"phone_number"`
+	Category        string            `json:"category,omitempty"`         // e.g. otp or marketing, selects the frequency caps
+	Message         string            `json:"message,omitempty"`          // either message, or template_id with params
+	TemplateID      string            `json:"template_id,omitempty"`      // template to render the message from
+	TemplateVersion int               `json:"template_version,omitempty"` // optional, defaults to the latest version
+	Params          map[string]string `json:"params,omitempty"`           // values for the template placeholders
+	SendAt          *time.Time        `json:"send_at,omitempty"`          // optional, RFC3339; the message is held back until then
+}
+
+type SendSmsBulk struct {
+	Messages []SendSms `json:"messages"`
 }
 
 type AddToBlacklist struct {
@@ -10,9 +22,37 @@ type AddToBlacklist struct {
 }
 
 type AddSmsEntryInDb struct {
-	RequestID   string `json:"request_id"`
-	PhoneNumber string `json:"phone_number"`
-	Message     string `json:"message"`
+	RequestID       string    `json:"request_id"`
+	TenantID        string    `json:"tenant_id"`
+	SenderId        string    `json:"sender_id"` // tenant's default sender id, empty for the gateway's own
+	Channel         string    `json:"channel"`
+	PhoneNumber     string    `json:"phone_number"`
+	Category        string    `json:"category"`
+	Message         string    `json:"message"`
+	Encoding        string    `json:"encoding"`
+	SegmentCount    int       `json:"segment_count"`
+	TemplateID      string    `json:"template_id"`      // empty when the caller sent a raw message
+	TemplateVersion int       `json:"template_version"` // version the message was rendered from
+	SendAt          time.Time `json:"send_at"`          // zero for an immediate send
+
+	TraceContext map[string]string `json:"-"` // trace of the api call, stored with the outbox entry
+}
+
+type CreateTemplate struct {
+	Name string `json:"name"`
+	Body string `json:"body"` // placeholders are written as {{name}}
+}
+
+type UpdateTemplate struct {
+	Body string `json:"body"`
+}
+
+type CreateAPIKey struct {
+	Owner       string     `json:"owner"`
+	TenantID    string     `json:"tenant_id"` // lowercase, as tenants are configured
+	Scopes      []string   `json:"scopes"`
+	IPAllowlist []string   `json:"ip_allowlist,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // optional, the key never expires without it
 }
 
 type GetSmsDetailsFromDbRequest struct {
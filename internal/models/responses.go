@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// bulk send outcome of a single recipient.
+const (
+	BULK_RESULT_ACCEPTED = "accepted"
+	BULK_RESULT_REJECTED = "rejected"
+)
+
+// SendSmsBulkResult is the per-recipient entry of the bulk send response, in request order.
+type SendSmsBulkResult struct {
+	PhoneNumber string            `json:"phone_number"`
+	Channel     string            `json:"channel,omitempty"`
+	RequestId   string            `json:"request_id,omitempty"`
+	Result      string            `json:"result"`             // accepted or rejected
+	Reason      string            `json:"reason,omitempty"`   // why the recipient was rejected
+	SendAt      *time.Time        `json:"send_at,omitempty"`  // set when the message was scheduled
+	Segments    *SegmentBreakdown `json:"segments,omitempty"` // set when the message was accepted
+}
+
+// SegmentBreakdown is how a message is encoded and split into billable sms parts.
+type SegmentBreakdown struct {
+	Encoding         string   `json:"encoding"`                     // GSM-7 or UCS-2
+	Characters       int      `json:"characters"`                   // characters of the message
+	Units            int      `json:"units"`                        // septets for GSM-7, utf-16 code units for UCS-2
+	SegmentCount     int      `json:"segment_count"`                // parts the message is sent and billed as
+	UnitsPerSegment  int      `json:"units_per_segment"`            // capacity of each part, lower once a message is split
+	NonGsmCharacters []string `json:"non_gsm_characters,omitempty"` // characters that forced UCS-2, first few only
+}
+
+// SMSPage is one page of a message listing, NextCursor is empty on the last page.
+type SMSPage struct {
+	Messages   []SMSRequest `json:"messages"`
+	NextCursor string       `json:"next_cursor,omitempty"` // pass as cursor to get the next page
+}
+
+// FieldError tells the caller which field of the request body was rejected and why.
+type FieldError struct {
+	Field string `json:"field"` // e.g. "phone_number" or "messages[3].phone_number"
+	Error string `json:"error"`
+}
+
+// CreatedAPIKey is returned when a key is created or rotated, the only time the plain key is shown.
+type CreatedAPIKey struct {
+	Key    string `json:"key"` // send as "Authorization: Bearer <key>"
+	APIKey APIKey `json:"api_key"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SMSStatus is the lifecycle state of an sms request, stored in sms_requests.status.
+type SMSStatus string
+
+const (
+	SMS_STATUS_SCHEDULED   SMSStatus = "Scheduled"   // waiting for its send_at, not yet released to kafka
+	SMS_STATUS_PENDING     SMSStatus = "Pending"     // accepted by the api, not yet on kafka
+	SMS_STATUS_QUEUED      SMSStatus = "Queued"      // waiting on kafka, either for its first attempt or a retry
+	SMS_STATUS_SENDING     SMSStatus = "Sending"     // a worker is handing it to the gateway
+	SMS_STATUS_SENT        SMSStatus = "Sent"        // accepted by the gateway
+	SMS_STATUS_DELIVERED   SMSStatus = "Delivered"   // the carrier confirmed delivery
+	SMS_STATUS_UNDELIVERED SMSStatus = "Undelivered" // the carrier reported it could not deliver
+	SMS_STATUS_FAILED      SMSStatus = "Failed"
+	SMS_STATUS_BLOCKED     SMSStatus = "Blocked"   // number is blacklisted
+	SMS_STATUS_THROTTLED   SMSStatus = "Throttled" // a per-recipient frequency cap was reached
+	SMS_STATUS_CANCELLED   SMSStatus = "Cancelled"
+	SMS_STATUS_EXPIRED     SMSStatus = "Expired"
+)
+
+// SMS_STATUSES lists every status, in lifecycle order.
+var SMS_STATUSES = []SMSStatus{
+	SMS_STATUS_SCHEDULED, SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_SENT, SMS_STATUS_DELIVERED,
+	SMS_STATUS_UNDELIVERED, SMS_STATUS_FAILED, SMS_STATUS_BLOCKED, SMS_STATUS_THROTTLED, SMS_STATUS_CANCELLED, SMS_STATUS_EXPIRED,
+}
+
+// ParseSMSStatus returns the status named s, ignoring case.
+func ParseSMSStatus(s string) (SMSStatus, bool) {
+	for _, status := range SMS_STATUSES {
+		if strings.EqualFold(string(status), s) {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// smsStatusTransitions lists, for every status, the statuses it may move to.
+// Statuses missing from the map are terminal.
+var smsStatusTransitions = map[SMSStatus][]SMSStatus{
+	SMS_STATUS_SCHEDULED: {SMS_STATUS_PENDING, SMS_STATUS_CANCELLED, SMS_STATUS_EXPIRED},
+	SMS_STATUS_PENDING:   {SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_FAILED, SMS_STATUS_BLOCKED, SMS_STATUS_THROTTLED, SMS_STATUS_CANCELLED, SMS_STATUS_EXPIRED},
+	SMS_STATUS_QUEUED:    {SMS_STATUS_SENDING, SMS_STATUS_FAILED, SMS_STATUS_BLOCKED, SMS_STATUS_THROTTLED, SMS_STATUS_CANCELLED, SMS_STATUS_EXPIRED},
+	SMS_STATUS_SENDING:   {SMS_STATUS_SENT, SMS_STATUS_QUEUED, SMS_STATUS_FAILED},
+	SMS_STATUS_SENT:      {SMS_STATUS_DELIVERED, SMS_STATUS_UNDELIVERED, SMS_STATUS_FAILED},
+}
+
+// CanTransition reports whether a request in status from may move to status to.
+func (from SMSStatus) CanTransition(to SMSStatus) bool {
+	for _, allowed := range smsStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transition is possible from the status.
+func (s SMSStatus) IsTerminal() bool {
+	return len(smsStatusTransitions[s]) == 0
+}
+
+// IllegalTransitionError is returned when a status change is not allowed by the transition table.
+type IllegalTransitionError struct {
+	From SMSStatus
+	To   SMSStatus
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("illegal sms status transition from %s to %s", e.From, e.To)
+}
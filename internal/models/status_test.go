@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// the ways a request normally goes, every step along them must be allowed.
+func TestSMSStatusLifecycles(t *testing.T) {
+	lifecycles := map[string][]SMSStatus{
+		"delivered":                   {SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_SENT, SMS_STATUS_DELIVERED},
+		"consumed before the ack":     {SMS_STATUS_PENDING, SMS_STATUS_SENDING, SMS_STATUS_SENT, SMS_STATUS_UNDELIVERED},
+		"retried after a gateway 5xx": {SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_SENT},
+		"rejected by the gateway":     {SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_FAILED},
+		"failed after it was sent":    {SMS_STATUS_SENDING, SMS_STATUS_SENT, SMS_STATUS_FAILED},
+		"blacklisted":                 {SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_BLOCKED},
+		"frequency capped":            {SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_THROTTLED},
+		"scheduled":                   {SMS_STATUS_SCHEDULED, SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_SENDING, SMS_STATUS_SENT},
+		"scheduled and cancelled":     {SMS_STATUS_SCHEDULED, SMS_STATUS_CANCELLED},
+		"expired in the queue":        {SMS_STATUS_PENDING, SMS_STATUS_QUEUED, SMS_STATUS_EXPIRED},
+	}
+
+	for name, lifecycle := range lifecycles {
+		for i := 1; i < len(lifecycle); i++ {
+			if !lifecycle[i-1].CanTransition(lifecycle[i]) {
+				t.Errorf("%s: %s -> %s is refused", name, lifecycle[i-1], lifecycle[i])
+			}
+		}
+	}
+}
+
+// a request never goes back, except Sending -> Queued for a retry, and never leaves a final status.
+func TestSMSStatusRefusedTransitions(t *testing.T) {
+	refused := [][2]SMSStatus{
+		{SMS_STATUS_QUEUED, SMS_STATUS_PENDING},
+		{SMS_STATUS_SENDING, SMS_STATUS_PENDING},
+		{SMS_STATUS_SENDING, SMS_STATUS_SENDING},
+		{SMS_STATUS_SENDING, SMS_STATUS_CANCELLED},
+		{SMS_STATUS_SENT, SMS_STATUS_QUEUED},
+		{SMS_STATUS_SENT, SMS_STATUS_SENDING},
+		{SMS_STATUS_PENDING, SMS_STATUS_SENT},
+		{SMS_STATUS_PENDING, SMS_STATUS_SCHEDULED},
+		{SMS_STATUS_SCHEDULED, SMS_STATUS_QUEUED},
+		{SMS_STATUS_DELIVERED, SMS_STATUS_UNDELIVERED},
+		{SMS_STATUS_UNDELIVERED, SMS_STATUS_DELIVERED},
+		{SMS_STATUS_FAILED, SMS_STATUS_QUEUED},
+		{SMS_STATUS_THROTTLED, SMS_STATUS_PENDING},
+		{SMS_STATUS_CANCELLED, SMS_STATUS_PENDING},
+		{SMSStatus("Unknown"), SMS_STATUS_SENDING},
+	}
+
+	for _, transition := range refused {
+		if transition[0].CanTransition(transition[1]) {
+			t.Errorf("%s -> %s is allowed", transition[0], transition[1])
+		}
+	}
+}
+
+func TestSMSStatusIsTerminal(t *testing.T) {
+	terminal := map[SMSStatus]bool{
+		SMS_STATUS_DELIVERED:   true,
+		SMS_STATUS_UNDELIVERED: true,
+		SMS_STATUS_FAILED:      true,
+		SMS_STATUS_BLOCKED:     true,
+		SMS_STATUS_THROTTLED:   true,
+		SMS_STATUS_CANCELLED:   true,
+		SMS_STATUS_EXPIRED:     true,
+	}
+	for _, status := range SMS_STATUSES {
+		if got := status.IsTerminal(); got != terminal[status] {
+			t.Errorf("%s.IsTerminal() = %v, want %v", status, got, terminal[status])
+		}
+	}
+}
+
+func TestIllegalTransitionError(t *testing.T) {
+	var err error = &IllegalTransitionError{From: SMS_STATUS_SENT, To: SMS_STATUS_QUEUED}
+	var illegal *IllegalTransitionError
+	if !errors.As(err, &illegal) || illegal.From != SMS_STATUS_SENT || illegal.To != SMS_STATUS_QUEUED {
+		t.Fatalf("errors.As() = %v, want the Sent -> Queued transition", illegal)
+	}
+	if want := "illegal sms status transition from Sent to Queued"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+// statuses come in lowercase from query strings, every known status must parse back whatever its case.
+func TestParseSMSStatus(t *testing.T) {
+	for _, status := range SMS_STATUSES {
+		for _, input := range []string{string(status), strings.ToLower(string(status)), strings.ToUpper(string(status))} {
+			if got, ok := ParseSMSStatus(input); !ok || got != status {
+				t.Errorf("ParseSMSStatus(%q) = %q, %v, want %q", input, got, ok, status)
+			}
+		}
+	}
+
+	for _, input := range []string{"", "Sendin", "Sent ", "Unknown"} {
+		if got, ok := ParseSMSStatus(input); ok {
+			t.Errorf("ParseSMSStatus(%q) = %q, want it refused", input, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/padam-meesho/NotificationService/kafka"
+)
+
+// the outbox relay hands stored requests to kafka. The api writes a request and its sms_outbox entry in one
+// logged batch and answers without talking to kafka; the relay produces the entries and deletes them once
+// the broker acknowledged them. Every replica runs the loop, but a shard is only relayed by the replica
+// holding its redis lease. A replica keeps renewing the leases it holds, so shards stay put between ticks,
+// and the leases of a replica that died run out after leaseTtl. Delivery is at least once: an entry whose
+// delete failed, or whose lease moved mid-batch, is produced again and the consumer skips the duplicate.
+
+type OutboxRelay interface {
+	Start()
+	Stop(ctx context.Context) error
+}
+
+type OutboxRelayImpl struct {
+	scyllaDao    dao.ScyllaDbDao
+	redisDao     dao.RedisDaoImpl
+	kafkaDao     kafka.KafkaDao
+	owner        string // identifies this replica in the shard leases
+	pollInterval time.Duration
+	batchSize    int
+	leaseTtl     time.Duration
+	stop         chan struct{} // closed to end the relay loop
+	done         chan struct{} // closed once the relay loop has returned
+}
+
+const OUTBOX_LEASE_PREFIX = "sms_outbox:"
+
+var (
+	relayOnce     sync.Once
+	relayInstance *OutboxRelayImpl
+)
+
+func NewOutboxRelay(appConfig *models.AppConfig, scyllaDao dao.ScyllaDbDaoImpl, redisDao dao.RedisDaoImpl, kafkaDao kafka.KafkaDao) *OutboxRelayImpl {
+	relayOnce.Do(func() {
+		cfg := appConfig.Outbox
+		batchSize := cfg.BatchSize
+		if batchSize <= 0 {
+			batchSize = 100
+		}
+		relayInstance = &OutboxRelayImpl{
+			scyllaDao:    scyllaDao,
+			redisDao:     redisDao,
+			kafkaDao:     kafkaDao,
+			owner:        uuid.New().String(),
+			pollInterval: utils.DurationOr(cfg.PollInterval, time.Second),
+			batchSize:    batchSize,
+			leaseTtl:     utils.DurationOr(cfg.LeaseTtl, 30*time.Second),
+			stop:         make(chan struct{}),
+			done:         make(chan struct{}),
+		}
+	})
+	return relayInstance
+}
+
+func GetOutboxRelay() *OutboxRelayImpl {
+	return relayInstance
+}
+
+// Start runs the relay loop in the background.
+func (r *OutboxRelayImpl) Start() {
+	logger := utils.ComponentLogger("outbox_relay")
+	logger.Info().
+		Str("owner", r.owner).
+		Int("shards", dao.OutboxShards()).
+		Dur("poll_interval", r.pollInterval).
+		Msg("Starting outbox relay")
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.tick()
+			}
+		}
+	}()
+}
+
+// Stop ends the relay loop, waits for a tick in progress to finish and gives up this replica's
+// shard leases, so the other replicas take the shards over right away.
+func (r *OutboxRelayImpl) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for shard := 0; shard < dao.OutboxShards(); shard++ {
+		_ = r.redisDao.ReleaseLease(ctx, OUTBOX_LEASE_PREFIX+strconv.Itoa(shard), r.owner)
+	}
+	return nil
+}
+
+func (r *OutboxRelayImpl) tick() {
+	for shard := 0; shard < dao.OutboxShards(); shard++ {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		r.relayShard(shard)
+	}
+}
+
+// relayShard produces the shard's entries if this replica holds the shard's lease.
+func (r *OutboxRelayImpl) relayShard(shard int) {
+	logger := utils.ComponentLogger("outbox_relay")
+	// the work has to be done before the lease runs out and another replica may take the shard.
+	ctx, cancel := context.WithTimeout(context.Background(), r.leaseTtl)
+	defer cancel()
+
+	acquired, err := r.redisDao.AcquireLease(ctx, OUTBOX_LEASE_PREFIX+strconv.Itoa(shard), r.owner, r.leaseTtl)
+	if err != nil || !acquired {
+		return
+	}
+
+	if relayed := r.drainShard(ctx, shard); relayed > 0 {
+		logger.Info().
+			Int("shard", shard).
+			Int("relayed", relayed).
+			Msg("Relayed outbox entries to Kafka")
+	}
+}
+
+// drainShard produces the shard's entries batch by batch and returns how many it deleted. It stops at
+// the first batch that was not fully acknowledged, the rest is tried again next tick.
+func (r *OutboxRelayImpl) drainShard(ctx context.Context, shard int) int {
+	relayed := 0
+	for ctx.Err() == nil {
+		entries, err := r.scyllaDao.GetOutboxEntries(ctx, shard, r.batchSize)
+		if err != nil || len(entries) == 0 {
+			break
+		}
+
+		done, complete := r.relayBatch(ctx, entries)
+		if len(done) > 0 {
+			err = r.scyllaDao.DeleteOutboxEntries(ctx, shard, done)
+			if err != nil {
+				break
+			}
+			relayed += len(done)
+		}
+		if !complete || len(entries) < r.batchSize {
+			break
+		}
+	}
+	return relayed
+}
+
+// relayBatch produces the entries and returns the ones that are done with, acknowledged by the broker or
+// impossible to produce, and whether that is all of them.
+func (r *OutboxRelayImpl) relayBatch(ctx context.Context, entries []models.OutboxEntry) ([]models.OutboxEntry, bool) {
+	logger := utils.ComponentLogger("outbox_relay")
+
+	done := make([]models.OutboxEntry, 0, len(entries))
+	produced := make([]models.OutboxEntry, 0, len(entries))
+	payloads := make([]models.KafkaPayload, 0, len(entries))
+	for _, entry := range entries {
+		payload, err := kafka.NewRequestPayload(entry.Channel, entry.TenantID, entry.RequestId, entry.PhoneNumber)
+		if err != nil {
+			// the channel is not registered on this build, retrying cannot help.
+			logger.Error().
+				Err(err).
+				Str("request_id", entry.RequestId).
+				Str("channel", entry.Channel).
+				Msg("Dropping outbox entry that cannot be produced")
+			done = append(done, entry)
+			continue
+		}
+		payload.TraceContext = entry.TraceContext
+		produced = append(produced, entry)
+		payloads = append(payloads, payload)
+	}
+	if len(payloads) == 0 {
+		return done, true
+	}
+
+	complete := true
+	for i, err := range r.kafkaDao.ProduceBatch(ctx, payloads) {
+		if err != nil {
+			complete = false
+			continue
+		}
+		done = append(done, produced[i])
+	}
+	return done, complete
+}
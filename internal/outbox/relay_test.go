@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/padam-meesho/NotificationService/channels"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/kafka"
+)
+
+// fakeOutbox is one shard of the outbox table.
+type fakeOutbox struct {
+	dao.ScyllaDbDao
+	entries []models.OutboxEntry
+}
+
+func (o *fakeOutbox) GetOutboxEntries(ctx context.Context, shard int, limit int) ([]models.OutboxEntry, error) {
+	return slices.Clone(o.entries[:min(limit, len(o.entries))]), nil
+}
+
+func (o *fakeOutbox) DeleteOutboxEntries(ctx context.Context, shard int, entries []models.OutboxEntry) error {
+	o.entries = slices.DeleteFunc(o.entries, func(entry models.OutboxEntry) bool {
+		return slices.ContainsFunc(entries, func(deleted models.OutboxEntry) bool { return deleted.RequestId == entry.RequestId })
+	})
+	return nil
+}
+
+func (o *fakeOutbox) requestIds() []string {
+	ids := make([]string, len(o.entries))
+	for i, entry := range o.entries {
+		ids[i] = entry.RequestId
+	}
+	return ids
+}
+
+// fakeProducer acknowledges every message but those of the requests in unacked.
+type fakeProducer struct {
+	kafka.KafkaDao
+	unacked  map[string]bool
+	produced []string
+}
+
+func (p *fakeProducer) ProduceBatch(ctx context.Context, payloads []models.KafkaPayload) []error {
+	errs := make([]error, len(payloads))
+	for i, payload := range payloads {
+		p.produced = append(p.produced, payload.RequestId)
+		if p.unacked[payload.RequestId] {
+			errs[i] = errors.New("Local: Message timed out")
+		}
+	}
+	return errs
+}
+
+func newTestRelay(batchSize int, requestIds ...string) (*OutboxRelayImpl, *fakeOutbox, *fakeProducer) {
+	channels.RegisterChannel(channels.NewSmsChannel(nil))
+
+	outbox := &fakeOutbox{}
+	for _, requestId := range requestIds {
+		outbox.entries = append(outbox.entries, models.OutboxEntry{RequestId: requestId, Channel: channels.SMS_CHANNEL_NAME})
+	}
+	producer := &fakeProducer{unacked: make(map[string]bool)}
+	return &OutboxRelayImpl{scyllaDao: outbox, kafkaDao: producer, batchSize: batchSize}, outbox, producer
+}
+
+func TestDrainShardRelaysEveryBatch(t *testing.T) {
+	relay, outbox, producer := newTestRelay(2, "req-1", "req-2", "req-3", "req-4", "req-5")
+
+	if relayed := relay.drainShard(context.Background(), 0); relayed != 5 {
+		t.Errorf("drainShard() = %d, want 5", relayed)
+	}
+	if len(outbox.entries) != 0 {
+		t.Errorf("outbox = %q, want every entry deleted", outbox.requestIds())
+	}
+	if want := []string{"req-1", "req-2", "req-3", "req-4", "req-5"}; !slices.Equal(producer.produced, want) {
+		t.Errorf("produced = %q, want %q", producer.produced, want)
+	}
+}
+
+// only acknowledged entries are deleted, and the relay stops at the batch so the shard stays in order.
+func TestDrainShardKeepsUnacknowledgedEntries(t *testing.T) {
+	relay, outbox, producer := newTestRelay(2, "req-1", "req-2", "req-3", "req-4")
+	producer.unacked["req-2"] = true
+
+	if relayed := relay.drainShard(context.Background(), 0); relayed != 1 {
+		t.Errorf("drainShard() = %d, want 1", relayed)
+	}
+	if want := []string{"req-2", "req-3", "req-4"}; !slices.Equal(outbox.requestIds(), want) {
+		t.Errorf("outbox = %q, want %q", outbox.requestIds(), want)
+	}
+	if want := []string{"req-1", "req-2"}; !slices.Equal(producer.produced, want) {
+		t.Errorf("produced = %q, want only the first batch %q", producer.produced, want)
+	}
+
+	// next tick the broker is back, the unacknowledged entry is produced again.
+	delete(producer.unacked, "req-2")
+	if relayed := relay.drainShard(context.Background(), 0); relayed != 3 || len(outbox.entries) != 0 {
+		t.Errorf("drainShard() = %d leaving %q, want the 3 remaining entries relayed", relayed, outbox.requestIds())
+	}
+}
+
+// an entry of a channel this build does not know can never be produced, it is dropped instead of blocking the shard.
+func TestDrainShardDropsUnknownChannel(t *testing.T) {
+	relay, outbox, producer := newTestRelay(10, "req-1", "req-2")
+	outbox.entries[0].Channel = "pigeon"
+
+	if relayed := relay.drainShard(context.Background(), 0); relayed != 2 || len(outbox.entries) != 0 {
+		t.Errorf("drainShard() = %d leaving %q, want both entries gone", relayed, outbox.requestIds())
+	}
+	if want := []string{"req-2"}; !slices.Equal(producer.produced, want) {
+		t.Errorf("produced = %q, want %q", producer.produced, want)
+	}
+}
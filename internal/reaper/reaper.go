@@ -0,0 +1,325 @@
+package reaper
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+	"github.com/padam-meesho/NotificationService/kafka"
+)
+
+// the reaper looks for requests that stopped moving, e.g. a row whose outbox entry was never written, a message
+// kafka lost, or a worker that died between claiming a request and hearing back from the gateway. Every replica
+// runs the loop, but only the one holding the reaper lease does the work; it keeps renewing the lease every run,
+// so the role stays put until that replica stops or dies. Candidates come from the sms_by_status index, a request
+// is stuck once its last status change is older than the threshold of its status. The index is read partition by
+// partition, for every known tenant and the day buckets between lookback before the threshold and the threshold.
+
+type StuckSMSReaper interface {
+	Start()
+	Stop(ctx context.Context) error
+}
+
+type StuckSMSReaperImpl struct {
+	redisDao  dao.RedisDaoImpl
+	owner     string // identifies this replica in the reaper lease
+	interval  time.Duration
+	leaseTtl  time.Duration
+	batchSize int
+	lookback  time.Duration // how far past its threshold a request is still looked for
+	policies  map[models.SMSStatus]models.ReaperPolicy
+	stop      chan struct{} // closed to end the reaper loop
+	done      chan struct{} // closed once the reaper loop has returned
+}
+
+const REAPER_LEASE = "stuck_sms_reaper"
+
+// how far past its threshold a request is looked for when neither reaper.lookback nor sms.statusIndexTtl is set.
+const DEFAULT_LOOKBACK = 7 * 24 * time.Hour
+
+// how many request ids an alert log line carries.
+const ALERT_SAMPLE_SIZE = 10
+
+var (
+	reaperOnce     sync.Once
+	reaperInstance *StuckSMSReaperImpl
+)
+
+func NewStuckSMSReaper(appConfig *models.AppConfig, redisDao dao.RedisDaoImpl) *StuckSMSReaperImpl {
+	reaperOnce.Do(func() {
+		cfg := appConfig.Reaper
+		interval := utils.DurationOr(cfg.Interval, time.Minute)
+		batchSize := cfg.BatchSize
+		if batchSize <= 0 {
+			batchSize = 500
+		}
+		// requests are not found once their index entries expired anyway.
+		lookback := utils.DurationOr(cfg.Lookback, utils.DurationOr(appConfig.Sms.StatusIndexTtl, DEFAULT_LOOKBACK))
+		reaperInstance = &StuckSMSReaperImpl{
+			redisDao:  redisDao,
+			owner:     uuid.New().String(),
+			interval:  interval,
+			leaseTtl:  utils.DurationOr(cfg.LeaseTtl, 3*interval),
+			batchSize: batchSize,
+			lookback:  lookback,
+			policies:  validPolicies(cfg.Policies),
+			stop:      make(chan struct{}),
+			done:      make(chan struct{}),
+		}
+	})
+	return reaperInstance
+}
+
+func GetStuckSMSReaper() *StuckSMSReaperImpl {
+	return reaperInstance
+}
+
+// validPolicies keeps the configured policies that can be applied to their status, the others are logged and dropped.
+func validPolicies(configured map[string]models.ReaperPolicy) map[models.SMSStatus]models.ReaperPolicy {
+	logger := utils.ComponentLogger("reaper")
+
+	policies := make(map[models.SMSStatus]models.ReaperPolicy, len(configured))
+	for name, policy := range configured {
+		status, ok := models.ParseSMSStatus(name)
+		reason := ""
+		switch {
+		case !ok:
+			reason = "unknown status"
+		case status.IsTerminal() || status == models.SMS_STATUS_SCHEDULED:
+			// scheduled requests wait on purpose, the scheduler releases them.
+			reason = "status is not one a request can get stuck in"
+		case policy.After <= 0:
+			reason = "threshold must be positive"
+		case policy.Action == models.REAPER_ACTION_REQUEUE && status != models.SMS_STATUS_PENDING && status != models.SMS_STATUS_QUEUED:
+			// a Sending request may have reached the gateway already, producing it again could send it twice.
+			reason = "only Pending and Queued requests can be requeued"
+		case policy.Action == models.REAPER_ACTION_FAIL && !status.CanTransition(models.SMS_STATUS_FAILED):
+			reason = "requests in this status cannot fail"
+		case policy.Action != models.REAPER_ACTION_REQUEUE && policy.Action != models.REAPER_ACTION_FAIL && policy.Action != models.REAPER_ACTION_ALERT:
+			reason = "unknown action"
+		}
+		if reason != "" {
+			logger.Error().
+				Str("status", name).
+				Str("action", policy.Action).
+				Dur("after", policy.After).
+				Str("reason", reason).
+				Msg("Ignoring reaper policy")
+			continue
+		}
+		policies[status] = policy
+	}
+	return policies
+}
+
+// Start runs the reaper loop in the background.
+func (r *StuckSMSReaperImpl) Start() {
+	logger := utils.ComponentLogger("reaper")
+	logger.Info().
+		Str("owner", r.owner).
+		Dur("interval", r.interval).
+		Int("policies", len(r.policies)).
+		Msg("Starting stuck SMS reaper")
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.run()
+			}
+		}
+	}()
+}
+
+// Stop ends the reaper loop, waits for a run in progress to finish and gives up the reaper lease,
+// so another replica takes the role over right away.
+func (r *StuckSMSReaperImpl) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	_ = r.redisDao.ReleaseLease(ctx, REAPER_LEASE, r.owner)
+	return nil
+}
+
+// run handles the stuck requests of every status with a policy, if this replica holds the reaper lease.
+func (r *StuckSMSReaperImpl) run() {
+	logger := utils.ComponentLogger("reaper")
+	if len(r.policies) == 0 {
+		return
+	}
+	// the work has to be done before the lease runs out and another replica may take over.
+	ctx, cancel := context.WithTimeout(context.Background(), r.leaseTtl)
+	defer cancel()
+
+	acquired, err := r.redisDao.AcquireLease(ctx, REAPER_LEASE, r.owner, r.leaseTtl)
+	if err != nil {
+		metrics.IncReaperRun(metrics.REAPER_RESULT_ERROR)
+		return
+	}
+	if !acquired {
+		metrics.IncReaperRun(metrics.REAPER_RESULT_SKIPPED)
+		return
+	}
+
+	start := time.Now()
+	cutoffs := make(map[models.SMSStatus]time.Time, len(r.policies))
+	for status, policy := range r.policies {
+		cutoffs[status] = start.Add(-policy.After)
+	}
+
+	tenants, err := r.knownTenants(ctx)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to list tenants to look for stuck SMS requests")
+		metrics.IncReaperRun(metrics.REAPER_RESULT_ERROR)
+		return
+	}
+
+	stuck, err := repo.GetNotificationServiceInstance().FindStuckSMSService(ctx, tenants, cutoffs, r.lookback, r.batchSize)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to look for stuck SMS requests")
+		metrics.IncReaperRun(metrics.REAPER_RESULT_ERROR)
+		return
+	}
+
+	summary := logger.Info()
+	failures := 0
+	for status, policy := range r.policies {
+		requests := stuck[status]
+		handled := r.apply(ctx, status, policy, requests)
+		failures += len(requests) - handled
+		metrics.SetReaperStuckRequests(string(status), policy.Action, len(requests))
+		summary = summary.
+			Int(strings.ToLower(string(status))+"_stuck", len(requests)).
+			Int(strings.ToLower(string(status))+"_handled", handled)
+	}
+	summary.
+		Int("failures", failures).
+		Dur("duration", time.Since(start)).
+		Msg("Stuck SMS reaper run completed")
+
+	if failures > 0 {
+		metrics.IncReaperRun(metrics.REAPER_RESULT_ERROR)
+		return
+	}
+	metrics.IncReaperRun(metrics.REAPER_RESULT_OK)
+}
+
+// knownTenants returns the default tenant, the tenants configured under tenants and those of managed api keys.
+// A tenant only ever seen in jwt claims has to be listed under tenants for its requests to be reaped.
+func (r *StuckSMSReaperImpl) knownTenants(ctx context.Context) ([]string, error) {
+	tenants := []string{models.DEFAULT_TENANT}
+	for tenantId := range config.GetAppConfig().Tenants {
+		if !slices.Contains(tenants, tenantId) {
+			tenants = append(tenants, tenantId)
+		}
+	}
+	keys, err := r.redisDao.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.TenantID != "" && !slices.Contains(tenants, key.TenantID) {
+			tenants = append(tenants, key.TenantID)
+		}
+	}
+	return tenants, nil
+}
+
+// apply runs the policy's action on the stuck requests of a status and returns how many it handled. A request
+// that changed status since it was found is left alone, the update is conditioned on the status it was read in.
+func (r *StuckSMSReaperImpl) apply(ctx context.Context, status models.SMSStatus, policy models.ReaperPolicy, requests []models.SMSRequest) int {
+	logger := utils.ComponentLogger("reaper")
+	if len(requests) == 0 {
+		return 0
+	}
+	serviceInstance := repo.GetNotificationServiceInstance()
+
+	switch policy.Action {
+	case models.REAPER_ACTION_ALERT:
+		sample := make([]string, 0, ALERT_SAMPLE_SIZE)
+		for _, request := range requests[:min(len(requests), ALERT_SAMPLE_SIZE)] {
+			sample = append(sample, request.ID)
+		}
+		logger.Error().
+			Str("status", string(status)).
+			Dur("after", policy.After).
+			Int("count", len(requests)).
+			Strs("sample_request_ids", sample).
+			Msg("SMS requests stuck in status")
+		return len(requests)
+
+	case models.REAPER_ACTION_FAIL:
+		handled := 0
+		for i := range requests {
+			err := serviceInstance.FailStuckSMSService(ctx, &requests[i], policy.After)
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("request_id", requests[i].ID).
+					Str("status", string(status)).
+					Msg("Failed to mark stuck SMS request as failed")
+				continue
+			}
+			handled++
+		}
+		return handled
+
+	case models.REAPER_ACTION_REQUEUE:
+		payloads := make([]models.KafkaPayload, 0, len(requests))
+		for i := range requests {
+			request := &requests[i]
+			payload, err := kafka.NewRequestPayload(request.Channel, request.TenantID, request.ID, request.PhoneNumber)
+			if err != nil {
+				continue
+			}
+			err = serviceInstance.RequeueStuckSMSService(ctx, request)
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("request_id", request.ID).
+					Str("status", string(status)).
+					Msg("Failed to requeue stuck SMS request")
+				continue
+			}
+			payloads = append(payloads, payload)
+		}
+		if len(payloads) == 0 {
+			return 0
+		}
+		// a request whose produce failed keeps its new updated_at, it is found again once its threshold passes.
+		handled := 0
+		for i, err := range kafka.GetKafkaDao().ProduceBatch(ctx, payloads) {
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("request_id", payloads[i].RequestId).
+					Msg("Failed to produce requeued SMS request to Kafka")
+				continue
+			}
+			handled++
+		}
+		return handled
+	}
+	return 0
+}
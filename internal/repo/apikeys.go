@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// this file has the admin services for the managed api keys. Authenticating a request with a key
+// is done by middlewares.AuthCheck straight against the dao.
+
+var (
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKeyChange = errors.New("invalid api key request")
+	ErrAPIKeyConflict      = errors.New("api key was changed concurrently, please retry")
+)
+
+func (notificationServiceInstance *NotificationServiceMethodsImpl) CreateAPIKeyService(ctx context.Context, req models.CreateAPIKey) (*models.CreatedAPIKey, error) {
+	logger := utils.RequestLogger(ctx, "service", "create_api_key")
+
+	if strings.TrimSpace(req.Owner) == "" {
+		return nil, fmt.Errorf("%w: owner is required", ErrInvalidAPIKeyChange)
+	}
+	if strings.TrimSpace(req.TenantID) == "" {
+		return nil, fmt.Errorf("%w: tenant_id is required", ErrInvalidAPIKeyChange)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyChange)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.ALL_SCOPES, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q, allowed are %s", ErrInvalidAPIKeyChange, scope, strings.Join(models.ALL_SCOPES, ", "))
+		}
+	}
+	for _, entry := range req.IPAllowlist {
+		if _, err := netip.ParsePrefix(entry); err != nil {
+			if _, err := netip.ParseAddr(entry); err != nil {
+				return nil, fmt.Errorf("%w: %q is neither an ip nor a cidr", ErrInvalidAPIKeyChange, entry)
+			}
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyChange)
+	}
+
+	id, secret, key, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := models.APIKey{
+		ID:          id,
+		Owner:       req.Owner,
+		TenantID:    strings.ToLower(strings.TrimSpace(req.TenantID)),
+		Scopes:      slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		IPAllowlist: req.IPAllowlist,
+		CreatedAt:   time.Now(),
+	}
+	apiKey.ExpiresAt = req.ExpiresAt
+
+	err = notificationServiceInstance.redisDao.SaveAPIKey(ctx, apiKey, utils.HashAPIKeySecret(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key")
+	}
+
+	logger.Info().
+		Str("key_id", id).
+		Str("owner", apiKey.Owner).
+		Str("key_tenant_id", apiKey.TenantID).
+		Strs("scopes", apiKey.Scopes).
+		Msg("Created api key")
+	return &models.CreatedAPIKey{Key: key, APIKey: apiKey}, nil
+}
+
+func (notificationServiceInstance *NotificationServiceMethodsImpl) ListAPIKeysService(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := notificationServiceInstance.redisDao.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys")
+	}
+	slices.SortFunc(keys, func(a, b models.APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return keys, nil
+}
+
+// RotateAPIKeyService replaces the secret of a key. The old secret stops working right away,
+// owner, scopes and id (and so the client's rate limits) stay the same.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) RotateAPIKeyService(ctx context.Context, keyId string) (*models.CreatedAPIKey, error) {
+	logger := utils.RequestLogger(ctx, "service", "rotate_api_key")
+
+	apiKey, secretHash, err := notificationServiceInstance.getActiveAPIKey(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	apiKey.RotatedAt = &now
+	err = notificationServiceInstance.replaceAPIKey(ctx, *apiKey, secretHash, utils.HashAPIKeySecret(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().
+		Str("key_id", keyId).
+		Str("owner", apiKey.Owner).
+		Msg("Rotated api key")
+	return &models.CreatedAPIKey{Key: keyId + "." + secret, APIKey: *apiKey}, nil
+}
+
+// RevokeAPIKeyService disables a key for good. It is kept, marked revoked, so it still shows up when auditing.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) RevokeAPIKeyService(ctx context.Context, keyId string) (*models.APIKey, error) {
+	logger := utils.RequestLogger(ctx, "service", "revoke_api_key")
+
+	apiKey, secretHash, err := notificationServiceInstance.getActiveAPIKey(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	// the secret hash is dropped as well, nothing can authenticate with a revoked key.
+	err = notificationServiceInstance.replaceAPIKey(ctx, *apiKey, secretHash, "")
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().
+		Str("key_id", keyId).
+		Str("owner", apiKey.Owner).
+		Msg("Revoked api key")
+	return apiKey, nil
+}
+
+// getActiveAPIKey loads a key that has not been revoked and the hash of its secret, revoked keys are reported as not found.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) getActiveAPIKey(ctx context.Context, keyId string) (*models.APIKey, string, error) {
+	apiKey, secretHash, err := notificationServiceInstance.redisDao.GetAPIKey(ctx, keyId)
+	if errors.Is(err, dao.ErrAPIKeyNotFound) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read api key %s", keyId)
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	return apiKey, secretHash, nil
+}
+
+// replaceAPIKey saves a key read by getActiveAPIKey, unless it was revoked or rotated since it was read.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) replaceAPIKey(ctx context.Context, apiKey models.APIKey, previousSecretHash string, secretHash string) error {
+	err := notificationServiceInstance.redisDao.ReplaceActiveAPIKey(ctx, apiKey, previousSecretHash, secretHash)
+	switch {
+	case errors.Is(err, dao.ErrAPIKeyNotFound):
+		return ErrAPIKeyNotFound
+	case errors.Is(err, dao.ErrAPIKeyChanged):
+		return ErrAPIKeyConflict
+	case err != nil:
+		return fmt.Errorf("failed to save api key %s", apiKey.ID)
+	}
+	return nil
+}
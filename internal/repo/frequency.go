@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+// frequency caps stop a buggy upstream from flooding one customer. Every recipient gets a sliding
+// window per message category in redis; the limits come from the frequencyCaps section of the config.
+
+const DEFAULT_FREQUENCY_CATEGORY = "default"
+
+// frequencyLimitsFor returns the caps for a category, falling back to the default ones.
+func frequencyLimitsFor(category string) (string, []models.FrequencyLimit) {
+	caps := config.GetAppConfig().FrequencyCaps
+	category = strings.ToLower(category)
+	if limits, ok := caps.Categories[category]; ok && category != "" {
+		return category, limits
+	}
+	return DEFAULT_FREQUENCY_CATEGORY, caps.Default
+}
+
+// frequencyCapKey is the redis key of the request's recipient and category, with the limits that apply to it.
+// ok is false when no cap applies.
+func frequencyCapKey(smsDetails *models.SMSRequest) (string, []models.FrequencyLimit, bool) {
+	if !config.GetAppConfig().FrequencyCaps.Enabled {
+		return "", nil, false
+	}
+	category, limits := frequencyLimitsFor(smsDetails.Category)
+	if len(limits) == 0 {
+		return "", nil, false
+	}
+	return category + ":" + smsDetails.PhoneNumber, limits, true
+}
+
+// checkFrequencyCaps counts the request against its recipient's windows and returns the limit that
+// was hit, or nil when it may be sent.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) checkFrequencyCaps(ctx context.Context, smsDetails *models.SMSRequest) (*models.FrequencyLimit, error) {
+	key, limits, ok := frequencyCapKey(smsDetails)
+	if !ok {
+		return nil, nil
+	}
+	return notificationServiceInstance.redisDao.CheckFrequencyCaps(ctx, key, smsDetails.ID, limits, time.Now())
+}
+
+// releaseFrequencyCaps gives back the slot checkFrequencyCaps took, once it is clear this worker will not hand
+// the request to the gateway. A retry of the request is counted again.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) releaseFrequencyCaps(ctx context.Context, smsDetails *models.SMSRequest) {
+	key, _, ok := frequencyCapKey(smsDetails)
+	if !ok {
+		return
+	}
+	// a slot that could not be released only runs out with its window.
+	_ = notificationServiceInstance.redisDao.ReleaseFrequencyCap(ctx, key, smsDetails.ID)
+}
+
+// claimedElsewhere tells, after this worker lost the claim on a request, whether another worker holding the same
+// message claimed it. The cap slot is then the other worker's too. When the row cannot be read the slot is kept,
+// going over a cap is worse than a slot that is held for nothing.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) claimedElsewhere(ctx context.Context, requestId string) bool {
+	current, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, requestId)
+	if err != nil {
+		return true
+	}
+	switch current.Status {
+	case models.SMS_STATUS_SENDING, models.SMS_STATUS_SENT, models.SMS_STATUS_DELIVERED, models.SMS_STATUS_UNDELIVERED:
+		return true
+	default:
+		return false
+	}
+}
+
+// frequencyCapComment describes the limit that was hit, it is stored as the request's failure comment.
+func frequencyCapComment(category string, limit *models.FrequencyLimit) string {
+	category, _ = frequencyLimitsFor(category)
+	return fmt.Sprintf("frequency cap of %d per %s reached for category %s", limit.Limit, limit.Window, category)
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// DEFAULT_HISTORY_WINDOW is how far back a history lookup without from goes.
+const DEFAULT_HISTORY_WINDOW = 30 * 24 * time.Hour
+
+// GetSMSHistoryService returns one page of the caller's tenant's messages to a phone number created between
+// from and to, newest first. A zero to means now, a zero from DEFAULT_HISTORY_WINDOW before to.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) GetSMSHistoryService(ctx context.Context, phoneNumber string, from, to time.Time, limit int, cursor string) (*models.SMSPage, error) {
+	logger := utils.RequestLogger(ctx, "service", "get_sms_history")
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DEFAULT_HISTORY_WINDOW)
+	}
+	if from.After(to) {
+		return nil, ErrInvalidTimeWindow
+	}
+	position, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, nextPageState, err := notificationServiceInstance.scyllaDao.GetSMSHistoryByPhone(ctx, tenantOf(ctx), phoneNumber, from, to, listLimit(limit), position.PageState)
+	if err != nil {
+		return nil, err
+	}
+	requestIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		requestIds = append(requestIds, entry.RequestId)
+	}
+	messages, err := notificationServiceInstance.getSMSDetailsInOrder(ctx, requestIds)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().
+		Str("phone_number", phoneNumber).
+		Int("count", len(messages)).
+		Bool("has_more", nextPageState != nil).
+		Msg("Retrieved SMS history")
+	nextCursor := ""
+	if nextPageState != nil {
+		nextCursor = encodeCursor(listCursor{PageState: nextPageState})
+	}
+	return &models.SMSPage{Messages: messages, NextCursor: nextCursor}, nil
+}
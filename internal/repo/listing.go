@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// message listings page through scylla. The cursor handed to the caller is where the next page starts: the
+// paging state of the query and, for listings spanning several partitions, the partition it belongs to.
+// It is only meaningful for the same query, the caller just passes it back.
+
+const (
+	DEFAULT_LIST_LIMIT = 50
+	MAX_LIST_LIMIT     = 200
+	// DEFAULT_STATUS_WINDOW is how far back a status listing without since goes.
+	DEFAULT_STATUS_WINDOW = 24 * time.Hour
+)
+
+var (
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrInvalidTimeWindow = errors.New("from must not be after to")
+)
+
+type listCursor struct {
+	Bucket    time.Time `json:"b,omitempty"`
+	PageState []byte    `json:"p,omitempty"`
+}
+
+func encodeCursor(cursor listCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor returns the zero cursor, the start of the listing, for an empty cursor.
+func decodeCursor(cursor string) (listCursor, error) {
+	var decoded listCursor
+	if cursor == "" {
+		return decoded, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(raw, &decoded) != nil {
+		return listCursor{}, ErrInvalidCursor
+	}
+	return decoded, nil
+}
+
+// listLimit clamps the page size asked for by the caller.
+func listLimit(limit int) int {
+	if limit <= 0 {
+		return DEFAULT_LIST_LIMIT
+	}
+	return min(limit, MAX_LIST_LIMIT)
+}
+
+// getSMSDetailsInOrder reads the requests of a listing page and returns them in the order of the page.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) getSMSDetailsInOrder(ctx context.Context, requestIds []string) ([]models.SMSRequest, error) {
+	requests, err := notificationServiceInstance.scyllaDao.GetSMSDetailsByIds(ctx, requestIds)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]models.SMSRequest, len(requests))
+	for _, request := range requests {
+		byId[request.ID] = request
+	}
+	messages := make([]models.SMSRequest, 0, len(requestIds))
+	for _, requestId := range requestIds {
+		if request, ok := byId[requestId]; ok {
+			messages = append(messages, request)
+		}
+	}
+	return messages, nil
+}
+
+// ListSMSByStatusService returns one page of the caller's tenant's requests currently in status whose last status change
+// was at or after since, most recent change first. A zero since means DEFAULT_STATUS_WINDOW ago; since is never further
+// back than sms.statusIndexTtl, the entries are gone by then.
+// The listing walks the day buckets of the status index from the newest one back to the one since falls into.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) ListSMSByStatusService(ctx context.Context, status models.SMSStatus, since time.Time, limit int, cursor string) (*models.SMSPage, error) {
+	logger := utils.RequestLogger(ctx, "service", "list_sms_by_status")
+
+	now := time.Now()
+	if since.IsZero() {
+		since = now.Add(-DEFAULT_STATUS_WINDOW)
+	}
+	if ttl := config.GetAppConfig().Sms.StatusIndexTtl; ttl > 0 && since.Before(now.Add(-ttl)) {
+		since = now.Add(-ttl)
+	}
+	position, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	bucket := dao.StatusBucket(now)
+	if !position.Bucket.IsZero() {
+		bucket = position.Bucket
+	}
+	lastBucket := dao.StatusBucket(since)
+
+	tenantID := tenantOf(ctx)
+	limit = listLimit(limit)
+	pageState := position.PageState
+	requestIds := make([]string, 0, limit)
+	var next *listCursor
+	for !bucket.Before(lastBucket) && len(requestIds) < limit {
+		entries, nextPageState, err := notificationServiceInstance.scyllaDao.GetSMSByStatus(ctx, tenantID, status, bucket, since, limit-len(requestIds), pageState)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			requestIds = append(requestIds, entry.RequestId)
+		}
+		if nextPageState != nil {
+			next = &listCursor{Bucket: bucket, PageState: nextPageState}
+			break
+		}
+		pageState = nil
+		bucket = bucket.Add(-dao.STATUS_BUCKET_SIZE)
+		next = nil
+		if !bucket.Before(lastBucket) {
+			next = &listCursor{Bucket: bucket}
+		}
+	}
+
+	requests, err := notificationServiceInstance.getSMSDetailsInOrder(ctx, requestIds)
+	if err != nil {
+		return nil, err
+	}
+	// an entry the index could not move on a status change is still listed under its old status.
+	messages := make([]models.SMSRequest, 0, len(requests))
+	for _, request := range requests {
+		if request.Status == status {
+			messages = append(messages, request)
+		}
+	}
+
+	logger.Info().
+		Str("status", string(status)).
+		Time("since", since).
+		Int("count", len(messages)).
+		Int("stale", len(requests)-len(messages)).
+		Bool("has_more", next != nil).
+		Msg("Listed SMS requests by status")
+	page := &models.SMSPage{Messages: messages}
+	if next != nil {
+		page.NextCursor = encodeCursor(*next)
+	}
+	return page, nil
+}
@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// FindStuckSMSService returns, for every status in cutoffs, up to limit requests of the given tenants that are still
+// in the status and last changed at or before its cutoff, but no earlier than lookback before it. It walks the day
+// buckets of every tenant and status from the oldest to the cutoff's, so the longest stuck requests come first.
+// Entries of the status index that no longer match their request are deleted on the way, so they do not take up the
+// limit of later runs.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) FindStuckSMSService(ctx context.Context, tenants []string, cutoffs map[models.SMSStatus]time.Time, lookback time.Duration, limit int) (map[models.SMSStatus][]models.SMSRequest, error) {
+	stuck := make(map[models.SMSStatus][]models.SMSRequest, len(cutoffs))
+	for status, cutoff := range cutoffs {
+		last := dao.StatusBucket(cutoff)
+		for bucket := dao.StatusBucket(cutoff.Add(-lookback)); !bucket.After(last); bucket = bucket.Add(dao.STATUS_BUCKET_SIZE) {
+			for _, tenantId := range tenants {
+				remaining := limit - len(stuck[status])
+				if remaining <= 0 {
+					break
+				}
+				requests, err := notificationServiceInstance.stuckInBucket(ctx, tenantId, status, bucket, cutoff, remaining)
+				if err != nil {
+					return nil, err
+				}
+				stuck[status] = append(stuck[status], requests...)
+			}
+		}
+	}
+	return stuck, nil
+}
+
+// stuckInBucket returns up to limit requests of a status bucket that are still in the status and last changed at or
+// before cutoff, and deletes the bucket's entries it read that no longer match their request.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) stuckInBucket(ctx context.Context, tenantId string, status models.SMSStatus, bucket time.Time, cutoff time.Time, limit int) ([]models.SMSRequest, error) {
+	logger := utils.RequestLogger(ctx, "service", "find_stuck_sms")
+
+	entries, err := notificationServiceInstance.scyllaDao.GetSMSByStatusBefore(ctx, tenantId, status, bucket, cutoff, limit)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	requestIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		requestIds = append(requestIds, entry.RequestId)
+	}
+	requests, err := notificationServiceInstance.scyllaDao.GetSMSDetailsByIds(ctx, requestIds)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]models.SMSRequest, len(requests))
+	for _, request := range requests {
+		byId[request.ID] = request
+	}
+
+	stuck := make([]models.SMSRequest, 0, len(entries))
+	for _, entry := range entries {
+		request, ok := byId[entry.RequestId]
+		// the entry is current only if it was written by the request's last status change.
+		if ok && request.Status == entry.Status && request.UpdatedAt.Equal(entry.UpdatedAt) {
+			stuck = append(stuck, request)
+			continue
+		}
+		logger.Debug().
+			Str("request_id", entry.RequestId).
+			Str("status", string(entry.Status)).
+			Msg("Deleting stale status index entry")
+		_ = notificationServiceInstance.scyllaDao.DeleteStatusIndexEntry(ctx, entry)
+	}
+	return stuck, nil
+}
+
+// RequeueStuckSMSService prepares a request stuck in Pending or Queued to be produced to kafka again. It keeps
+// its status and only has updated_at moved, so it is not picked up again before its threshold passes once more.
+// The caller produces the request afterwards. Sending requests are never requeued, they may have been sent already.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) RequeueStuckSMSService(ctx context.Context, smsDetails *models.SMSRequest) error {
+	logger := utils.RequestLogger(ctx, "service", "requeue_stuck_sms")
+
+	switch smsDetails.Status {
+	case models.SMS_STATUS_PENDING, models.SMS_STATUS_QUEUED:
+		err := notificationServiceInstance.scyllaDao.UpdateSMSDetailsInDB(ctx, smsDetails, smsDetails.Status)
+		if err != nil {
+			return err
+		}
+		logger.Info().
+			Str("request_id", smsDetails.ID).
+			Str("status", string(smsDetails.Status)).
+			Msg("Requeueing stuck SMS request")
+		return nil
+	default:
+		return &models.IllegalTransitionError{From: smsDetails.Status, To: models.SMS_STATUS_QUEUED}
+	}
+}
+
+// FailStuckSMSService marks a request that has been in its status for longer than after as failed,
+// with a failure code naming the status it was stuck in, e.g. STUCK_SENDING.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) FailStuckSMSService(ctx context.Context, smsDetails *models.SMSRequest, after time.Duration) error {
+	smsDetails.FailureCode = "STUCK_" + strings.ToUpper(string(smsDetails.Status))
+	smsDetails.FailureComments = fmt.Sprintf("stuck in %s for more than %s", smsDetails.Status, after)
+	return notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_FAILED)
+}
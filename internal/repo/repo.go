@@ -2,12 +2,21 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/gocql/gocql"
 	"github.com/google/uuid"
+	"github.com/padam-meesho/NotificationService/channels"
+	"github.com/padam-meesho/NotificationService/config"
 	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/gateway"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
 	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // okay we need to have a struct that has the DAOs which we shall need to implement the changes.
@@ -16,19 +25,30 @@ import (
 
 type NotificationServiceMethods interface {
 	InitNotificationService(redisDao dao.RedisDaoImpl, scyllaDao dao.ScyllaDbDaoImpl)
-	SendSMSService(ctx context.Context, req models.SendSms) (string, error)
-	HandleKafkaMessages(ctx context.Context, requestId string) error
-	SendMessage(req *models.SMSRequest)
+	SendSMSService(ctx context.Context, req models.SendSms) (string, models.SegmentBreakdown, error)
+	SendBulkSMSService(ctx context.Context, reqs []models.SendSms) ([]models.SendSmsBulkResult, error)
+	HandleKafkaMessages(ctx context.Context, requestId string, attempt int) error
+	HandleExhaustedRetries(ctx context.Context, requestId string, attempt int, lastErr error) error
+	HandleDeliveryReceipt(ctx context.Context, provider string, receipt models.DeliveryReceipt) error
+	ReleaseScheduledSMSService(ctx context.Context, entry models.ScheduledSMS) (bool, error)
+	FindStuckSMSService(ctx context.Context, tenants []string, cutoffs map[models.SMSStatus]time.Time, lookback time.Duration, limit int) (map[models.SMSStatus][]models.SMSRequest, error)
+	RequeueStuckSMSService(ctx context.Context, smsDetails *models.SMSRequest) error
+	FailStuckSMSService(ctx context.Context, smsDetails *models.SMSRequest, after time.Duration) error
+	SendMessage(ctx context.Context, req *models.SMSRequest) (string, error)
 	GetSMSService(ctx context.Context, reqID string) (any, error)
+	GetSMSHistoryService(ctx context.Context, phoneNumber string, from, to time.Time, limit int, cursor string) (*models.SMSPage, error)
+	ListSMSByStatusService(ctx context.Context, status models.SMSStatus, since time.Time, limit int, cursor string) (*models.SMSPage, error)
 	GetBlacklistService(ctx context.Context) ([]string, error)
 	AddToBlacklistService(ctx context.Context, req models.AddToBlacklist) error
 	RemoveFromBlacklistService(ctx context.Context, number string) (bool, error)
+	MigrateBlacklistService(ctx context.Context, defaultRegion string) error
 }
 
 type NotificationServiceMethodsImpl struct {
 	// here we have to have all the DAO clients.
+	// delivery goes through the channel of each request, see the channels package.
 	redisDao  dao.RedisDaoImpl
-	scyllaDao dao.ScyllaDbDaoImpl
+	scyllaDao dao.ScyllaDbDao
 }
 
 var (
@@ -47,8 +67,38 @@ func GetNotificationServiceInstance() *NotificationServiceMethodsImpl {
 	return notificationServiceInstance
 }
 
+// tenantOf returns the tenant of the authenticated caller, put on the context by the auth middleware.
+func tenantOf(ctx context.Context) string {
+	if tenantID := utils.GetTenant(ctx); tenantID != "" {
+		return tenantID
+	}
+	return models.DEFAULT_TENANT
+}
+
+// ownedByTenant tells whether smsDetails belongs to tenantID, requests stored before tenants existed belong to the default one.
+func ownedByTenant(smsDetails *models.SMSRequest, tenantID string) bool {
+	rowTenant := smsDetails.TenantID
+	if rowTenant == "" {
+		rowTenant = models.DEFAULT_TENANT
+	}
+	return rowTenant == tenantID
+}
+
+// tenantSenderId returns the tenant's default sender id, empty to use the gateway's.
+func tenantSenderId(tenantID string) string {
+	return config.GetAppConfig().Tenants[tenantID].SenderId
+}
+
+// traceContextOf returns the W3C trace context of ctx, so work done later on a request's behalf,
+// like relaying it from the outbox, joins the trace of the api call.
+func traceContextOf(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
 // now we have to define the service functions which shall have use the repo/dao layer.
-func (notificationServiceInstance *NotificationServiceMethodsImpl) SendSMSService(ctx context.Context, req models.SendSms) (string, error) {
+func (notificationServiceInstance *NotificationServiceMethodsImpl) SendSMSService(ctx context.Context, req models.SendSms) (string, models.SegmentBreakdown, error) {
 	logger := utils.RequestLogger(ctx, "service", "send_sms")
 
 	// here we have to hit the db and create the db entry and then publish to the producer too.
@@ -59,35 +109,227 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) SendSMSServic
 	logger.Info().
 		Str("request_id", requestID).
 		Str("phone_number", req.PhoneNumber).
+		Str("channel", req.Channel).
+		Str("template_id", req.TemplateID).
 		Msg("Processing SMS send request")
 
+	channel, err := channels.GetChannel(req.Channel)
+	if err != nil {
+		return "", models.SegmentBreakdown{}, err
+	}
+	err = channel.Validate(&req)
+	if err != nil {
+		return "", models.SegmentBreakdown{}, err
+	}
+
+	template, err := notificationServiceInstance.renderSendRequest(ctx, channel, &req, nil)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("request_id", requestID).
+			Msg("Failed to render SMS message")
+		return "", models.SegmentBreakdown{}, err
+	}
+
+	segments, err := countSegments(req.Message)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("request_id", requestID).
+			Msg("SMS message has too many segments")
+		return "", segments, err
+	}
+
+	tenantID := tenantOf(ctx)
 	incomingReq := models.AddSmsEntryInDb{
-		RequestID:   requestID,
-		PhoneNumber: req.PhoneNumber,
-		Message:     req.Message,
+		RequestID:    requestID,
+		TenantID:     tenantID,
+		SenderId:     tenantSenderId(tenantID),
+		Channel:      channel.Name(),
+		PhoneNumber:  req.PhoneNumber,
+		Category:     req.Category,
+		Message:      req.Message,
+		Encoding:     segments.Encoding,
+		SegmentCount: segments.SegmentCount,
+		TraceContext: traceContextOf(ctx),
+	}
+	if template != nil {
+		incomingReq.TemplateID = template.ID
+		incomingReq.TemplateVersion = template.Version
 	}
-	err := notificationServiceInstance.scyllaDao.InsertSMSRequest(ctx, incomingReq)
+	// the caller has already resolved send_at with ResolveSendAt, so a set value is always in the future.
+	if req.SendAt != nil {
+		incomingReq.SendAt = *req.SendAt
+	}
+	err = notificationServiceInstance.scyllaDao.InsertSMSRequest(ctx, incomingReq)
 	if err != nil {
 		logger.Error().
 			Err(err).
 			Str("request_id", requestID).
 			Str("phone_number", req.PhoneNumber).
 			Msg("Failed to insert SMS request into database")
-		return "", err
+		return "", models.SegmentBreakdown{}, err
 	}
 
 	logger.Info().
 		Str("request_id", requestID).
 		Str("phone_number", req.PhoneNumber).
+		Str("encoding", segments.Encoding).
+		Int("segment_count", segments.SegmentCount).
 		Msg("Successfully created SMS request")
-	return requestID, nil
+	return requestID, segments, nil
+}
+
+// ResolveSendAt validates an optional send_at. It returns the zero time when the message should go
+// out right away (no send_at, or one that has already passed) and an error when it is too far ahead.
+func ResolveSendAt(sendAt *time.Time) (time.Time, error) {
+	if sendAt == nil || !sendAt.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	maxAhead := config.GetAppConfig().Scheduler.MaxScheduleAhead
+	if maxAhead > 0 && sendAt.After(time.Now().Add(maxAhead)) {
+		return time.Time{}, fmt.Errorf("send_at can be at most %s in the future", maxAhead)
+	}
+	return *sendAt, nil
+}
+
+// SendBulkSMSService validates, blacklist-checks and stores a batch of requests.
+// It returns one result per request in the same order, rejected recipients carry the reason.
+// Producing the accepted requests to kafka is left to the caller, as for a single send.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) SendBulkSMSService(ctx context.Context, reqs []models.SendSms) ([]models.SendSmsBulkResult, error) {
+	logger := utils.RequestLogger(ctx, "service", "send_bulk_sms")
+
+	logger.Info().
+		Int("count", len(reqs)).
+		Msg("Processing bulk SMS send request")
+
+	results := make([]models.SendSmsBulkResult, len(reqs))
+	sendAts := make([]time.Time, len(reqs))
+	renderedFrom := make([]*models.SMSTemplate, len(reqs))
+	segments := make([]models.SegmentBreakdown, len(reqs))
+	channelNames := make([]string, len(reqs))
+	templates := map[string]*models.SMSTemplate{}
+	numbers := make([]string, 0, len(reqs))
+	candidates := make([]int, 0, len(reqs))
+	for i := range reqs {
+		req := &reqs[i]
+		results[i].PhoneNumber = req.PhoneNumber
+		channel, err := channels.GetChannel(req.Channel)
+		if err == nil {
+			err = channel.Validate(req)
+		}
+		if err != nil {
+			results[i].Result = models.BULK_RESULT_REJECTED
+			results[i].Reason = err.Error()
+			continue
+		}
+		channelNames[i] = channel.Name()
+		results[i].Channel = channel.Name()
+		template, err := notificationServiceInstance.renderSendRequest(ctx, channel, req, templates)
+		if err != nil {
+			results[i].Result = models.BULK_RESULT_REJECTED
+			results[i].Reason = err.Error()
+			continue
+		}
+		renderedFrom[i] = template
+		segments[i], err = countSegments(req.Message)
+		if err != nil {
+			results[i].Result = models.BULK_RESULT_REJECTED
+			results[i].Reason = err.Error()
+			continue
+		}
+		sendAt, err := ResolveSendAt(req.SendAt)
+		if err != nil {
+			results[i].Result = models.BULK_RESULT_REJECTED
+			results[i].Reason = err.Error()
+			continue
+		}
+		sendAts[i] = sendAt
+		numbers = append(numbers, req.PhoneNumber)
+		candidates = append(candidates, i)
+	}
+
+	isBlacklisted, err := notificationServiceInstance.redisDao.CheckNumbersInBlacklistedSet(ctx, numbers)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to check blacklist for bulk request")
+		return nil, fmt.Errorf("failed to verify blacklisted numbers")
+	}
+
+	accepted := make([]int, 0, len(candidates))
+	for n, i := range candidates {
+		if isBlacklisted[n] {
+			results[i].Result = models.BULK_RESULT_REJECTED
+			results[i].Reason = "number is blacklisted"
+			continue
+		}
+		accepted = append(accepted, i)
+	}
+
+	tenantID := tenantOf(ctx)
+	senderId := tenantSenderId(tenantID)
+	traceContext := traceContextOf(ctx)
+	batchSize := config.GetAppConfig().Sms.BulkBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	for start := 0; start < len(accepted); start += batchSize {
+		batch := accepted[start:min(start+batchSize, len(accepted))]
+		entries := make([]models.AddSmsEntryInDb, 0, len(batch))
+		for _, i := range batch {
+			entry := models.AddSmsEntryInDb{
+				RequestID:    uuid.New().String(),
+				TenantID:     tenantID,
+				SenderId:     senderId,
+				Channel:      channelNames[i],
+				PhoneNumber:  reqs[i].PhoneNumber,
+				Category:     reqs[i].Category,
+				Message:      reqs[i].Message,
+				Encoding:     segments[i].Encoding,
+				SegmentCount: segments[i].SegmentCount,
+				SendAt:       sendAts[i],
+				TraceContext: traceContext,
+			}
+			if renderedFrom[i] != nil {
+				entry.TemplateID = renderedFrom[i].ID
+				entry.TemplateVersion = renderedFrom[i].Version
+			}
+			entries = append(entries, entry)
+		}
+
+		errs := notificationServiceInstance.scyllaDao.InsertSMSRequestsBatch(ctx, entries)
+		for n, i := range batch {
+			if errs[n] != nil {
+				results[i].Result = models.BULK_RESULT_REJECTED
+				results[i].Reason = "failed to store request"
+				continue
+			}
+			results[i].Result = models.BULK_RESULT_ACCEPTED
+			results[i].RequestId = entries[n].RequestID
+			results[i].Segments = &segments[i]
+			if !sendAts[i].IsZero() {
+				results[i].SendAt = &sendAts[i]
+			}
+		}
+	}
+
+	logger.Info().
+		Int("count", len(reqs)).
+		Int("accepted", len(accepted)).
+		Msg("Stored bulk SMS requests")
+	return results, nil
 }
 
-func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMessages(ctx context.Context, requestId string) error {
+// HandleKafkaMessages processes one delivery attempt of a request.
+// A returned error means the attempt failed transiently and the consumer should retry it,
+// permanent outcomes (sent, rejected by the gateway, blacklisted) are recorded on the row and return nil.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMessages(ctx context.Context, requestId string, attempt int) error {
 	logger := utils.RequestLogger(ctx, "service", "handle_kafka_message")
 
 	logger.Info().
 		Str("request_id", requestId).
+		Int("attempt", attempt).
 		Msg("Processing Kafka message for SMS request")
 
 	// db call
@@ -97,8 +339,18 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMe
 			Err(err).
 			Str("request_id", requestId).
 			Msg("Failed to retrieve SMS details from database")
+		return err
+	}
+
+	// a redelivered message for a request that is already being sent or is finished must not be sent again.
+	if !smsDetails.Status.CanTransition(models.SMS_STATUS_SENDING) {
+		logger.Warn().
+			Str("request_id", requestId).
+			Str("status", string(smsDetails.Status)).
+			Msg("SMS request is not in a sendable status, skipping")
 		return nil
 	}
+	smsDetails.Attempts = attempt
 
 	isPresent, err := notificationServiceInstance.redisDao.CheckNumberInBlacklistedSet(ctx, smsDetails.PhoneNumber)
 	if err != nil {
@@ -107,7 +359,7 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMe
 			Str("request_id", requestId).
 			Str("phone_number", smsDetails.PhoneNumber).
 			Msg("Failed to check blacklist status")
-		return nil
+		return err
 	}
 
 	if isPresent {
@@ -115,11 +367,51 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMe
 			Str("request_id", requestId).
 			Str("phone_number", smsDetails.PhoneNumber).
 			Msg("SMS blocked - phone number is blacklisted")
-		// here we have to update the db with failure
 		smsDetails.FailureComments = "Number is blacklisted"
 		smsDetails.FailureCode = "400"
-		smsDetails.Status = "Failure"
-		return nil
+		return notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_BLOCKED)
+	}
+
+	limitHit, err := notificationServiceInstance.checkFrequencyCaps(ctx, smsDetails)
+	if err != nil {
+		return err
+	}
+	if limitHit != nil {
+		logger.Warn().
+			Str("request_id", requestId).
+			Str("phone_number", smsDetails.PhoneNumber).
+			Str("category", smsDetails.Category).
+			Int("limit", limitHit.Limit).
+			Dur("window", limitHit.Window).
+			Msg("SMS throttled - recipient frequency cap reached")
+		smsDetails.FailureCode = "FREQUENCY_CAP"
+		smsDetails.FailureComments = frequencyCapComment(smsDetails.Category, limitHit)
+		return notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_THROTTLED)
+	}
+
+	// claim the request before calling the gateway, so a second worker holding the same message backs off.
+	err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_SENDING)
+	if errors.Is(err, dao.ErrConcurrentUpdate) && smsDetails.Status == models.SMS_STATUS_PENDING {
+		// the producer's delivery report can move the request from Pending to Queued while we hold the message,
+		// that is not another worker, so the claim is tried again from Queued.
+		current, getErr := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, requestId)
+		if getErr != nil {
+			err = getErr
+		} else if current.Status == models.SMS_STATUS_QUEUED {
+			smsDetails = current
+			smsDetails.Attempts = attempt
+			err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_SENDING)
+		}
+	}
+	if err != nil {
+		// the cap slot is only kept for the worker that won the claim.
+		if !errors.Is(err, dao.ErrConcurrentUpdate) || !notificationServiceInstance.claimedElsewhere(ctx, requestId) {
+			notificationServiceInstance.releaseFrequencyCaps(ctx, smsDetails)
+		}
+		if errors.Is(err, dao.ErrConcurrentUpdate) {
+			return nil
+		}
+		return err
 	}
 
 	// if not present
@@ -127,40 +419,324 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleKafkaMe
 		Str("request_id", requestId).
 		Str("phone_number", smsDetails.PhoneNumber).
 		Msg("Sending SMS to external service")
-	notificationServiceInstance.SendMessage(smsDetails)
+	providerMessageId, sendErr := notificationServiceInstance.SendMessage(ctx, smsDetails)
 
-	// message is sent so we update the status
-	smsDetails.Status = "Success"
+	// record what the gateway actually told us, not an optimistic success.
+	if channel, err := channels.GetChannel(smsDetails.Channel); err == nil {
+		smsDetails.Provider = channel.Provider()
+	}
+	if sendErr != nil {
+		// the gateway did not take the message, so it does not count against the caps.
+		notificationServiceInstance.releaseFrequencyCaps(ctx, smsDetails)
+		gwErr := gateway.AsGatewayError(smsDetails.Provider, sendErr)
+		smsDetails.FailureCode = gwErr.Code
+		smsDetails.FailureComments = gwErr.Message
+		nextStatus := models.SMS_STATUS_FAILED
+		if gwErr.Retryable {
+			// the consumer will try again, so the request goes back to waiting on kafka.
+			nextStatus = models.SMS_STATUS_QUEUED
+		}
+		err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, nextStatus)
+		if err != nil {
+			return err
+		}
+		if gwErr.Retryable {
+			return gwErr
+		}
+		return nil
+	}
 
-	err = notificationServiceInstance.scyllaDao.UpdateSMSDetailsInDB(ctx, smsDetails)
+	smsDetails.ProviderMessageId = providerMessageId
+	smsDetails.FailureCode = ""
+	smsDetails.FailureComments = ""
+	// written before the status so a fast delivery receipt can already find the request.
+	err = notificationServiceInstance.scyllaDao.InsertProviderMessageMapping(ctx, smsDetails.Provider, providerMessageId, requestId)
 	if err != nil {
 		logger.Error().
 			Err(err).
 			Str("request_id", requestId).
-			Msg("Failed to update SMS status in database")
-		return err
+			Str("provider_message_id", providerMessageId).
+			Msg("Failed to record provider message id, delivery receipts for it will not match")
+	}
+	err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_SENT)
+	if err != nil {
+		// the gateway already has the message, retrying would send it twice.
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Str("provider_message_id", providerMessageId).
+			Msg("SMS sent but failed to record Sent status")
+		return nil
 	}
 
 	logger.Info().
 		Str("request_id", requestId).
 		Str("phone_number", smsDetails.PhoneNumber).
+		Str("provider_message_id", providerMessageId).
 		Msg("Successfully processed SMS request")
 	return nil
 }
 
-func (notificationServiceInstance *NotificationServiceMethodsImpl) SendMessage(req *models.SMSRequest) {
-	logger := utils.ComponentLogger("sms_gateway")
+// HandleExhaustedRetries marks a request as failed once the consumer has given up on it
+// and parked it on the dead-letter topic.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleExhaustedRetries(ctx context.Context, requestId string, attempt int, lastErr error) error {
+	logger := utils.RequestLogger(ctx, "service", "handle_exhausted_retries")
+
+	smsDetails, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, requestId)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Msg("Failed to retrieve SMS details from database")
+		return err
+	}
+
+	if smsDetails.Status.IsTerminal() {
+		logger.Info().
+			Str("request_id", requestId).
+			Str("status", string(smsDetails.Status)).
+			Msg("SMS request already finished, nothing to mark")
+		return nil
+	}
+
+	smsDetails.Attempts = attempt
+	smsDetails.FailureCode = "RETRIES_EXHAUSTED"
+	if lastErr != nil {
+		smsDetails.FailureComments = lastErr.Error()
+	}
+
+	err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_FAILED)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Msg("Failed to mark SMS request as failed")
+		return err
+	}
+
+	logger.Warn().
+		Str("request_id", requestId).
+		Int("attempt", attempt).
+		Msg("SMS request moved to dead-letter topic")
+	return nil
+}
+
+// ReleaseScheduledSMSService moves a due scheduled request to Pending and hands it to the outbox relay.
+// The status change is a lightweight transaction on the request's own partition, which cannot share a batch with
+// the other tables, so it comes first; the outbox entry is then written in the batch that deletes the scheduled
+// entry. If that batch fails the request is found again, already Pending, on the next tick.
+// It returns false when the request was not released, e.g. because it was cancelled meanwhile.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) ReleaseScheduledSMSService(ctx context.Context, entry models.ScheduledSMS) (bool, error) {
+	logger := utils.RequestLogger(ctx, "service", "release_scheduled_sms")
+
+	smsDetails, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, entry.RequestId)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", entry.RequestId).
+			Msg("Failed to retrieve SMS details from database")
+		return false, err
+	}
+
+	switch smsDetails.Status {
+	case models.SMS_STATUS_SCHEDULED:
+		err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_PENDING)
+		if err != nil {
+			return false, err
+		}
+	case models.SMS_STATUS_PENDING:
+		// released before but the outbox entry was not written, writing it now is harmless.
+	default:
+		logger.Info().
+			Str("request_id", entry.RequestId).
+			Str("status", string(smsDetails.Status)).
+			Msg("Scheduled SMS request is no longer releasable")
+		return false, notificationServiceInstance.scyllaDao.DeleteScheduledSMS(ctx, entry)
+	}
+
+	err = notificationServiceInstance.scyllaDao.MoveScheduledSMSToOutbox(ctx, entry, *smsDetails)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkSMSQueuedService records that the broker acknowledged the request's message at partition and offset,
+// and moves the request from Pending to Queued. A consumer may already have picked the message up by then,
+// the request then keeps its newer status and only the position is recorded.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) MarkSMSQueuedService(ctx context.Context, requestId string, partition int32, offset int64) error {
+	logger := utils.RequestLogger(ctx, "service", "mark_sms_queued")
+
+	err := notificationServiceInstance.scyllaDao.RecordKafkaPosition(ctx, requestId, partition, offset)
+	if err != nil {
+		return err
+	}
+
+	smsDetails, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, requestId)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Msg("Failed to retrieve SMS details from database")
+		return err
+	}
+	if smsDetails.Status != models.SMS_STATUS_PENDING {
+		logger.Debug().
+			Str("request_id", requestId).
+			Str("status", string(smsDetails.Status)).
+			Msg("SMS request already past Pending, keeping its status")
+		return nil
+	}
+
+	err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, models.SMS_STATUS_QUEUED)
+	if err != nil && !errors.Is(err, dao.ErrConcurrentUpdate) {
+		return err
+	}
+	return nil
+}
+
+// ErrUnknownProviderMessage is returned for a delivery receipt whose provider message id we never issued.
+var ErrUnknownProviderMessage = errors.New("no sms request found for provider message id")
+
+// ErrReceiptBeforeSent is returned for a delivery receipt that arrived before its request was marked Sent,
+// e.g. while the worker that sent it has not recorded the gateway's answer yet. The provider is asked to redeliver it.
+var ErrReceiptBeforeSent = errors.New("sms request not marked sent yet")
+
+// HandleDeliveryReceipt advances the request a delivery receipt refers to to Delivered or Undelivered.
+// Receipts for requests already in a final state are ignored, providers commonly resend them; a receipt for a
+// request still on its way to Sent returns ErrReceiptBeforeSent, so it is not lost.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) HandleDeliveryReceipt(ctx context.Context, provider string, receipt models.DeliveryReceipt) error {
+	logger := utils.RequestLogger(ctx, "service", "handle_delivery_receipt")
+
+	requestId, err := notificationServiceInstance.scyllaDao.GetRequestIdByProviderMessageId(ctx, provider, receipt.ProviderMessageId)
+	if err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return ErrUnknownProviderMessage
+		}
+		return err
+	}
+
+	smsDetails, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, requestId)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Msg("Failed to retrieve SMS details from database")
+		return err
+	}
+
+	if smsDetails.Status.IsTerminal() {
+		logger.Info().
+			Str("request_id", requestId).
+			Str("status", string(smsDetails.Status)).
+			Str("receipt_status", string(receipt.Status)).
+			Msg("Ignoring delivery receipt for finished SMS request")
+		return nil
+	}
+	if !smsDetails.Status.CanTransition(receipt.Status) {
+		logger.Info().
+			Str("request_id", requestId).
+			Str("status", string(smsDetails.Status)).
+			Str("receipt_status", string(receipt.Status)).
+			Msg("Delivery receipt arrived before SMS request was marked sent")
+		return ErrReceiptBeforeSent
+	}
+
+	smsDetails.CarrierErrorCode = receipt.CarrierErrorCode
+	smsDetails.DeliveredAt = receipt.DeliveredAt
+	err = notificationServiceInstance.transitionSMSStatus(ctx, smsDetails, receipt.Status)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("request_id", requestId).
+			Msg("Failed to apply delivery receipt")
+		return err
+	}
+
+	logger.Info().
+		Str("request_id", requestId).
+		Str("provider", provider).
+		Str("status", string(receipt.Status)).
+		Str("carrier_error_code", receipt.CarrierErrorCode).
+		Msg("Applied delivery receipt")
+	return nil
+}
+
+// transitionSMSStatus moves the request to status to, if the transition table allows it,
+// and persists the change conditioned on the row still being in the status it was read in.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) transitionSMSStatus(ctx context.Context, smsDetails *models.SMSRequest, to models.SMSStatus) error {
+	logger := utils.RequestLogger(ctx, "service", "transition_status")
+
+	from := smsDetails.Status
+	if !from.CanTransition(to) {
+		err := &models.IllegalTransitionError{From: from, To: to}
+		logger.Error().
+			Err(err).
+			Str("request_id", smsDetails.ID).
+			Msg("Rejected illegal SMS status transition")
+		return err
+	}
+
+	smsDetails.Status = to
+	err := notificationServiceInstance.scyllaDao.UpdateSMSDetailsInDB(ctx, smsDetails, from)
+	if err != nil {
+		smsDetails.Status = from
+		return err
+	}
+
+	metrics.IncStatusTransition(string(from), string(to))
+	logger.Info().
+		Str("request_id", smsDetails.ID).
+		Str("from_status", string(from)).
+		Str("to_status", string(to)).
+		Msg("SMS status transitioned")
+	return nil
+}
+
+// SendMessage delivers the request through its channel.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) SendMessage(ctx context.Context, req *models.SMSRequest) (string, error) {
+	logger := utils.RequestLogger(ctx, "sms_gateway", "send")
+
+	channel, err := channels.GetChannel(req.Channel)
+	if err != nil {
+		// a row for a channel this deployment does not run can never be sent.
+		metrics.IncGatewaySend(req.Channel, metrics.GATEWAY_OUTCOME_FAILED, "UNKNOWN_CHANNEL")
+		return "", &gateway.GatewayError{Provider: req.Channel, Code: "UNKNOWN_CHANNEL", Message: err.Error()}
+	}
 
 	logger.Info().
 		Str("request_id", req.ID).
 		Str("phone_number", req.PhoneNumber).
+		Str("channel", channel.Name()).
+		Str("provider", channel.Provider()).
 		Msg("Sending SMS via external gateway")
 
-	fmt.Printf("RequestID: %v | PhoneNumber: %v | Message: %s\n", req.ID, req.PhoneNumber, req.Message)
+	providerMessageId, err := channel.Deliver(ctx, req)
+	if err != nil {
+		gwErr := gateway.AsGatewayError(channel.Provider(), err)
+		metrics.IncGatewaySend(channel.Provider(), metrics.GATEWAY_OUTCOME_FAILED, gwErr.Code)
+		logger.Error().
+			Err(err).
+			Str("request_id", req.ID).
+			Str("error_code", gwErr.Code).
+			Bool("retryable", gwErr.Retryable).
+			Msg("SMS gateway rejected the message")
+		return "", gwErr
+	}
+
+	metrics.IncGatewaySend(channel.Provider(), metrics.GATEWAY_OUTCOME_SENT, "")
+	logger.Info().
+		Str("request_id", req.ID).
+		Str("provider_message_id", providerMessageId).
+		Msg("SMS accepted by gateway")
+	return providerMessageId, nil
 }
 
 // we have to define a model for this.
 // we have to fix a database schema fr
+// ErrSMSNotFound is returned for request ids that do not exist or belong to another tenant.
+var ErrSMSNotFound = errors.New("sms request not found")
+
 func (notificationServiceInstance *NotificationServiceMethodsImpl) GetSMSService(ctx context.Context, reqID string) (any, error) {
 	logger := utils.RequestLogger(ctx, "service", "get_sms")
 
@@ -168,8 +744,11 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) GetSMSService
 		Str("request_id", reqID).
 		Msg("Retrieving SMS request details")
 
-	// we have to hit db and fetch the sms details by request ID.
+	// we have to hit db and fetch the sms details by request ID, only the caller's tenant's requests are visible.
 	smsDetails, err := notificationServiceInstance.scyllaDao.GetSMSDetailsFromDB(ctx, reqID)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, ErrSMSNotFound
+	}
 	if err != nil {
 		logger.Error().
 			Err(err).
@@ -177,10 +756,18 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) GetSMSService
 			Msg("Failed to retrieve SMS details from database")
 		return nil, fmt.Errorf("failed to retrieve SMS details for request ID %s", reqID)
 	}
+	// a request of another tenant is reported like one that does not exist.
+	if !ownedByTenant(smsDetails, tenantOf(ctx)) {
+		logger.Warn().
+			Str("request_id", reqID).
+			Str("row_tenant_id", smsDetails.TenantID).
+			Msg("SMS request belongs to another tenant")
+		return nil, ErrSMSNotFound
+	}
 
 	logger.Info().
 		Str("request_id", reqID).
-		Str("status", smsDetails.Status).
+		Str("status", string(smsDetails.Status)).
 		Msg("Successfully retrieved SMS details")
 	return smsDetails, nil
 }
@@ -271,3 +858,38 @@ func (notificationServiceInstance *NotificationServiceMethodsImpl) RemoveFromBla
 
 	return success, nil
 }
+
+// MigrateBlacklistService rewrites blacklist entries stored before numbers were normalised into their E.164 form,
+// so lookups with canonical numbers find them. Entries that cannot be parsed are left as they are.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) MigrateBlacklistService(ctx context.Context, defaultRegion string) error {
+	logger := utils.RequestLogger(ctx, "service", "migrate_blacklist")
+
+	blacklistedNumbers, err := notificationServiceInstance.redisDao.GetAllBlacklistedNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	replacements := make(map[string]string)
+	unparsable := 0
+	for _, number := range blacklistedNumbers {
+		canonical, err := utils.NormalizePhoneNumber(number, defaultRegion)
+		if err != nil {
+			unparsable++
+			continue
+		}
+		if canonical != number {
+			replacements[number] = canonical
+		}
+	}
+
+	err = notificationServiceInstance.redisDao.ReplaceBlacklistedNumbers(ctx, replacements)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().
+		Int("migrated", len(replacements)).
+		Int("unparsable", unparsable).
+		Msg("Blacklist migrated to E.164")
+	return nil
+}
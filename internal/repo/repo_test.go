@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// fakeScyllaDao serves requests from memory, any method a test does not expect panics on the nil interface.
+type fakeScyllaDao struct {
+	dao.ScyllaDbDao
+	requests map[string]models.SMSRequest
+}
+
+func (fake fakeScyllaDao) GetSMSDetailsFromDB(ctx context.Context, requestId string) (*models.SMSRequest, error) {
+	sms, ok := fake.requests[requestId]
+	if !ok {
+		return nil, gocql.ErrNotFound
+	}
+	return &sms, nil
+}
+
+func newTestNotificationService(requests ...models.SMSRequest) *NotificationServiceMethodsImpl {
+	fake := fakeScyllaDao{requests: make(map[string]models.SMSRequest)}
+	for _, sms := range requests {
+		fake.requests[sms.ID] = sms
+	}
+	return &NotificationServiceMethodsImpl{scyllaDao: fake}
+}
+
+func TestGetSMSServiceScopesToTenant(t *testing.T) {
+	service := newTestNotificationService(models.SMSRequest{ID: "req-acme", TenantID: "acme", Status: models.SMS_STATUS_SENT})
+	acme := utils.WithTenant(context.Background(), "acme")
+	globex := utils.WithTenant(context.Background(), "globex")
+
+	got, err := service.GetSMSService(acme, "req-acme")
+	if err != nil {
+		t.Fatalf("GetSMSService() of the caller's own request error = %v", err)
+	}
+	if sms := got.(*models.SMSRequest); sms.ID != "req-acme" {
+		t.Errorf("GetSMSService() = %s, want req-acme", sms.ID)
+	}
+
+	// another tenant's request must look exactly like one that does not exist.
+	if _, err := service.GetSMSService(globex, "req-acme"); !errors.Is(err, ErrSMSNotFound) {
+		t.Errorf("GetSMSService() of another tenant's request error = %v, want ErrSMSNotFound", err)
+	}
+	if _, err := service.GetSMSService(globex, "req-missing"); !errors.Is(err, ErrSMSNotFound) {
+		t.Errorf("GetSMSService() of an unknown request error = %v, want ErrSMSNotFound", err)
+	}
+}
+
+// rows written before tenants existed have no tenant and belong to the default one.
+func TestGetSMSServiceDefaultTenant(t *testing.T) {
+	service := newTestNotificationService(models.SMSRequest{ID: "req-legacy", Status: models.SMS_STATUS_DELIVERED})
+
+	if _, err := service.GetSMSService(context.Background(), "req-legacy"); err != nil {
+		t.Errorf("GetSMSService() of a legacy request without a tenant on the context error = %v", err)
+	}
+	if _, err := service.GetSMSService(utils.WithTenant(context.Background(), models.DEFAULT_TENANT), "req-legacy"); err != nil {
+		t.Errorf("GetSMSService() of a legacy request for the default tenant error = %v", err)
+	}
+	if _, err := service.GetSMSService(utils.WithTenant(context.Background(), "acme"), "req-legacy"); !errors.Is(err, ErrSMSNotFound) {
+		t.Errorf("GetSMSService() of a legacy request for acme error = %v, want ErrSMSNotFound", err)
+	}
+}
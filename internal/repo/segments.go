@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// the segments of a message are counted once it is rendered, so the limit applies to templated messages too.
+
+// SegmentLimitError is returned for messages split into more parts than sms.maxSegments allows.
+type SegmentLimitError struct {
+	Segments    models.SegmentBreakdown
+	MaxSegments int
+}
+
+func (e *SegmentLimitError) Error() string {
+	return fmt.Sprintf("message needs %d %s segments, at most %d are allowed", e.Segments.SegmentCount, e.Segments.Encoding, e.MaxSegments)
+}
+
+// countSegments returns the segment breakdown of a rendered message, or a *SegmentLimitError when it has too many.
+func countSegments(message string) (models.SegmentBreakdown, error) {
+	segments := utils.CountSegments(message)
+	maxSegments := config.GetAppConfig().Sms.MaxSegments
+	if maxSegments > 0 && segments.SegmentCount > maxSegments {
+		return segments, &SegmentLimitError{Segments: segments, MaxSegments: maxSegments}
+	}
+	return segments, nil
+}
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/padam-meesho/NotificationService/channels"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// this file has the template services: crud on the versioned templates and rendering
+// a send request's template_id + params into the message that is stored and sent.
+// templates belong to the caller's tenant, another tenant's template is reported as not found.
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrInvalidTemplate  = errors.New("template body must not be empty")
+	ErrTemplateConflict = errors.New("template was updated concurrently, please retry")
+)
+
+func (notificationServiceInstance *NotificationServiceMethodsImpl) CreateTemplateService(ctx context.Context, req models.CreateTemplate) (*models.SMSTemplate, error) {
+	logger := utils.RequestLogger(ctx, "service", "create_template")
+
+	if req.Body == "" {
+		return nil, ErrInvalidTemplate
+	}
+
+	template := models.SMSTemplate{
+		TenantID:     tenantOf(ctx),
+		ID:           uuid.New().String(),
+		Version:      1,
+		Name:         req.Name,
+		Body:         req.Body,
+		Placeholders: utils.ExtractPlaceholders(req.Body),
+		CreatedAt:    time.Now(),
+	}
+	_, err := notificationServiceInstance.scyllaDao.InsertTemplateVersion(ctx, template)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to create template")
+		return nil, fmt.Errorf("failed to create template")
+	}
+
+	logger.Info().
+		Str("template_id", template.ID).
+		Strs("placeholders", template.Placeholders).
+		Msg("Successfully created template")
+	return &template, nil
+}
+
+// UpdateTemplateService adds a new version; earlier versions stay readable for auditing.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) UpdateTemplateService(ctx context.Context, templateId string, req models.UpdateTemplate) (*models.SMSTemplate, error) {
+	logger := utils.RequestLogger(ctx, "service", "update_template")
+
+	if req.Body == "" {
+		return nil, ErrInvalidTemplate
+	}
+
+	latest, err := notificationServiceInstance.GetTemplateService(ctx, templateId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	template := models.SMSTemplate{
+		TenantID:     latest.TenantID,
+		ID:           templateId,
+		Version:      latest.Version + 1,
+		Name:         latest.Name,
+		Body:         req.Body,
+		Placeholders: utils.ExtractPlaceholders(req.Body),
+		CreatedAt:    time.Now(),
+	}
+	applied, err := notificationServiceInstance.scyllaDao.InsertTemplateVersion(ctx, template)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("template_id", templateId).
+			Msg("Failed to update template")
+		return nil, fmt.Errorf("failed to update template")
+	}
+	if !applied {
+		return nil, ErrTemplateConflict
+	}
+
+	logger.Info().
+		Str("template_id", templateId).
+		Int("version", template.Version).
+		Msg("Successfully added template version")
+	return &template, nil
+}
+
+// GetTemplateService returns a version of a template, the latest one when version is 0.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) GetTemplateService(ctx context.Context, templateId string, version int) (*models.SMSTemplate, error) {
+	template, err := notificationServiceInstance.scyllaDao.GetTemplate(ctx, tenantOf(ctx), templateId, version)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve template %s", templateId)
+	}
+	return template, nil
+}
+
+func (notificationServiceInstance *NotificationServiceMethodsImpl) GetTemplateVersionsService(ctx context.Context, templateId string) ([]models.SMSTemplate, error) {
+	templates, err := notificationServiceInstance.scyllaDao.GetTemplateVersions(ctx, tenantOf(ctx), templateId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve template %s", templateId)
+	}
+	if len(templates) == 0 {
+		return nil, ErrTemplateNotFound
+	}
+	return templates, nil
+}
+
+func (notificationServiceInstance *NotificationServiceMethodsImpl) DeleteTemplateService(ctx context.Context, templateId string) error {
+	if _, err := notificationServiceInstance.GetTemplateService(ctx, templateId, 0); err != nil {
+		return err
+	}
+	err := notificationServiceInstance.scyllaDao.DeleteTemplate(ctx, tenantOf(ctx), templateId)
+	if err != nil {
+		return fmt.Errorf("failed to delete template %s", templateId)
+	}
+	return nil
+}
+
+// renderSendRequest fills in the message of a send request that uses a template, rendered by the request's
+// channel, and returns the template version it was rendered from. Requests with a raw message are returned as they are.
+// templates caches lookups across the requests of one bulk call, it may be nil.
+func (notificationServiceInstance *NotificationServiceMethodsImpl) renderSendRequest(ctx context.Context, channel channels.Channel, req *models.SendSms, templates map[string]*models.SMSTemplate) (*models.SMSTemplate, error) {
+	if req.TemplateID == "" {
+		if req.Message == "" {
+			return nil, errors.New("either message or template_id is required")
+		}
+		return nil, nil
+	}
+	if req.Message != "" {
+		return nil, errors.New("message and template_id cannot both be set")
+	}
+
+	cacheKey := fmt.Sprintf("%s:%d", req.TemplateID, req.TemplateVersion)
+	template, ok := templates[cacheKey]
+	if !ok {
+		var err error
+		template, err = notificationServiceInstance.GetTemplateService(ctx, req.TemplateID, req.TemplateVersion)
+		if err != nil {
+			return nil, err
+		}
+		if templates != nil {
+			templates[cacheKey] = template
+		}
+	}
+
+	message, err := channel.Render(template, req.Params)
+	if err != nil {
+		return nil, fmt.Errorf("template %s version %d: %w", template.ID, template.Version, err)
+	}
+	req.Message = message
+	return template, nil
+}
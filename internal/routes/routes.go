@@ -2,8 +2,12 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/padam-meesho/NotificationService/config"
 	"github.com/padam-meesho/NotificationService/internal/handlers"
+	"github.com/padam-meesho/NotificationService/internal/lifecycle"
 	"github.com/padam-meesho/NotificationService/internal/middlewares"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func SetUpRoutes() {
@@ -11,21 +15,56 @@ func SetUpRoutes() {
 	// define a base route and try to group routes, and within that grouping apply the middleware.
 	// now try to define the different endpoints
 	router := gin.Default()
+	// lets the services see values the middlewares put on the request context (trace id, api client) through *gin.Context.
+	router.ContextWithFallback = true
+	router.Use(middlewares.MetricsMiddleware())
 	router.GET("/health", healthHandler)
-	api := router.Group("/v1", middlewares.AuthCheck(), middlewares.TraceMiddleware()) // this is to add the base route and apply middleware on it.
+	router.GET("/metrics", gin.WrapH(promhttp.Handler())) // prometheus scrape endpoint, not behind auth like /health
+	appConfig := config.GetAppConfig()
+	// the trace comes first, so the auth middleware's log lines carry the trace id too.
+	api := router.Group("/v1", middlewares.TraceMiddleware(), middlewares.AuthCheck(appConfig)) // this is to add the base route and apply middleware on it.
+
+	// every route group gets its own rate limit per client, see rateLimit and tenants in the config.
+	sendLimit := middlewares.RateLimit("send", appConfig)
+	readLimit := middlewares.RateLimit("read", appConfig)
+
+	// each route requires a scope on the caller's api key.
+	canSend := middlewares.RequireScope(models.SCOPE_SMS_SEND)
+	canRead := middlewares.RequireScope(models.SCOPE_SMS_READ)
 
 	// sms apis
 	smsApi := api.Group("/sms") // these need to be put in the route handlers
-	smsApi.POST("/send", handlers.SendSmsController)
-	smsApi.GET("/:request_id", handlers.GetSmsController) // this shall act as a path variable
+	idempotencyTtl := appConfig.Sms.IdempotencyTtl
+	smsApi.POST("/send", canSend, sendLimit, middlewares.IdempotencyCheck(idempotencyTtl), handlers.SendSmsController)
+	smsApi.POST("/send/bulk", canSend, sendLimit, middlewares.IdempotencyCheck(idempotencyTtl), handlers.SendBulkSmsController)
+	smsApi.GET("", canRead, readLimit, handlers.ListSmsController)                                                      // ?phone_number=&from=&to= or ?status=&since=, with &limit=&cursor=
+	smsApi.GET("/:request_id", canRead, readLimit, handlers.GetSmsController)                                           // this shall act as a path variable
+	smsApi.POST("/dlr/:provider", middlewares.RequireScope(models.SCOPE_DLR_WRITE), handlers.DeliveryReceiptController) // delivery receipts pushed by the sms providers
+
+	// template apis
+	templateApi := api.Group("/templates", middlewares.RateLimit("templates", appConfig))
+	canWriteTemplates := middlewares.RequireScope(models.SCOPE_TEMPLATES_WRITE)
+	templateApi.POST("", canWriteTemplates, handlers.CreateTemplateController)
+	templateApi.GET("/:template_id", canRead, handlers.GetTemplateController)
+	templateApi.GET("/:template_id/versions", canRead, handlers.GetTemplateVersionsController)
+	templateApi.PUT("/:template_id", canWriteTemplates, handlers.UpdateTemplateController) // adds a new version
+	templateApi.DELETE("/:template_id", canWriteTemplates, handlers.DeleteTemplateController)
 
 	// blacklist apis
-	blacklistApi := api.Group("/blacklist")
-	blacklistApi.GET("", handlers.GetBlacklistController)
-	blacklistApi.POST("", handlers.AddToBlacklistController)
-	blacklistApi.DELETE("/:number", handlers.RemoveFromBlacklistController) // this shall act as the route which shall be hit to remove a number from a blacklist.
+	blacklistApi := api.Group("/blacklist", middlewares.RateLimit("blacklist", appConfig))
+	blacklistApi.GET("", middlewares.RequireScope(models.SCOPE_BLACKLIST_READ), handlers.GetBlacklistController)
+	blacklistApi.POST("", middlewares.RequireScope(models.SCOPE_BLACKLIST_WRITE), handlers.AddToBlacklistController)
+	blacklistApi.DELETE("/:number", middlewares.RequireScope(models.SCOPE_BLACKLIST_DELETE), handlers.RemoveFromBlacklistController) // this shall act as the route which shall be hit to remove a number from a blacklist.
+
+	// api key management
+	keysApi := api.Group("/admin/keys", middlewares.RequireScope(models.SCOPE_KEYS_ADMIN))
+	keysApi.POST("", handlers.CreateAPIKeyController)
+	keysApi.GET("", handlers.ListAPIKeysController)
+	keysApi.POST("/:key_id/rotate", handlers.RotateAPIKeyController)
+	keysApi.DELETE("/:key_id", handlers.RevokeAPIKeyController)
 
-	router.Run(":3333")
+	// the server starts last and stops first, so no request comes in once the consumer and the stores go away.
+	lifecycle.GetLifecycle().Append(apiServerHook(appConfig, router))
 }
 
 func healthHandler(c *gin.Context) {
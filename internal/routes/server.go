@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/padam-meesho/NotificationService/internal/lifecycle"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+const DEFAULT_SERVER_ADDR = ":3333"
+
+// apiServerHook serves handler on the configured address. On stop the server stops accepting
+// connections and gives in-flight requests up to the drain timeout before cutting them off.
+func apiServerHook(appConfig *models.AppConfig, handler http.Handler) lifecycle.Hook {
+	logger := utils.ComponentLogger("api_server")
+
+	addr := appConfig.Server.Addr
+	if addr == "" {
+		addr = DEFAULT_SERVER_ADDR
+	}
+	drainTimeout := appConfig.Server.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = 15 * time.Second
+	}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+
+	return lifecycle.Hook{
+		Name: "api_server",
+		OnStart: func(ctx context.Context) error {
+			// listening up front surfaces a taken port as a start failure instead of a background one.
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				err := server.Serve(listener)
+				if err != nil && !errors.Is(err, http.ErrServerClosed) {
+					lifecycle.GetLifecycle().Fail(err)
+				}
+			}()
+			logger.Info().
+				Str("addr", addr).
+				Msg("API server listening")
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, drainTimeout)
+			defer cancel()
+			err := server.Shutdown(ctx)
+			if err != nil {
+				// requests still running past the drain timeout are cut off.
+				logger.Error().
+					Err(err).
+					Dur("drain_timeout", drainTimeout).
+					Msg("API server did not drain in time, closing remaining connections")
+				return errors.Join(err, server.Close())
+			}
+			return nil
+		},
+	}
+}
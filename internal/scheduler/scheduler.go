@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/padam-meesho/NotificationService/dao"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// the scheduler releases scheduled messages once their send_at has passed, by moving them to Pending and into
+// the outbox, from where the outbox relay produces them to kafka like any other request.
+// scheduled_sms is partitioned into time buckets; every replica runs the loop, but a bucket is
+// only processed by the replica holding its redis lease. A shared checkpoint remembers the oldest
+// bucket that may still hold entries, so a tick never rescans buckets that were already drained.
+
+type SmsScheduler interface {
+	Start()
+	Stop(ctx context.Context) error
+}
+
+type SmsSchedulerImpl struct {
+	scyllaDao    dao.ScyllaDbDaoImpl
+	redisDao     dao.RedisDaoImpl
+	owner        string // identifies this replica in the bucket leases
+	tickInterval time.Duration
+	bucketSize   time.Duration
+	leaseTtl     time.Duration
+	maxLookback  time.Duration
+	stop         chan struct{} // closed to end the release loop
+	done         chan struct{} // closed once the release loop has returned
+}
+
+const SCHEDULER_CHECKPOINT = "scheduled_sms"
+
+var (
+	schedulerOnce     sync.Once
+	schedulerInstance *SmsSchedulerImpl
+)
+
+func NewSmsScheduler(appConfig *models.AppConfig, scyllaDao dao.ScyllaDbDaoImpl, redisDao dao.RedisDaoImpl) *SmsSchedulerImpl {
+	schedulerOnce.Do(func() {
+		cfg := appConfig.Scheduler
+		schedulerInstance = &SmsSchedulerImpl{
+			scyllaDao:    scyllaDao,
+			redisDao:     redisDao,
+			owner:        uuid.New().String(),
+			tickInterval: utils.DurationOr(cfg.TickInterval, 5*time.Second),
+			bucketSize:   utils.DurationOr(cfg.BucketSize, time.Minute),
+			leaseTtl:     utils.DurationOr(cfg.LeaseTtl, 30*time.Second),
+			maxLookback:  utils.DurationOr(cfg.MaxLookback, time.Hour),
+			stop:         make(chan struct{}),
+			done:         make(chan struct{}),
+		}
+	})
+	return schedulerInstance
+}
+
+func GetSmsScheduler() *SmsSchedulerImpl {
+	return schedulerInstance
+}
+
+// Start runs the release loop in the background.
+func (s *SmsSchedulerImpl) Start() {
+	logger := utils.ComponentLogger("scheduler")
+	logger.Info().
+		Str("owner", s.owner).
+		Dur("tick_interval", s.tickInterval).
+		Dur("bucket_size", s.bucketSize).
+		Msg("Starting SMS scheduler")
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.tickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.tick()
+			}
+		}
+	}()
+}
+
+// Stop ends the release loop and waits for a tick in progress to finish. Leases of the buckets it held
+// are not released, they run out after leaseTtl and another replica takes the buckets over.
+func (s *SmsSchedulerImpl) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tick goes over the buckets from the checkpoint to the current one. It has no overall deadline, a backlog
+// after an outage is drained in one tick however long it takes; every bucket gets its own budget instead,
+// see processBucket, and the tick stops between buckets when the scheduler is stopped.
+func (s *SmsSchedulerImpl) tick() {
+	logger := utils.ComponentLogger("scheduler")
+
+	now := time.Now().UTC()
+	current := dao.ScheduleBucket(now)
+
+	start, ok, err := s.checkpoint()
+	if err != nil {
+		return
+	}
+	if !ok {
+		start = dao.ScheduleBucket(now.Add(-s.maxLookback))
+	}
+
+	// the checkpoint only moves past buckets that are confirmed empty, and never past the current one.
+	canAdvance := true
+	for bucket := start; !bucket.After(current); bucket = bucket.Add(s.bucketSize) {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		if !s.processBucket(bucket, now, canAdvance && bucket.Before(current)) {
+			canAdvance = false
+		}
+	}
+
+	logger.Debug().
+		Time("from_bucket", start).
+		Time("to_bucket", current).
+		Msg("Scheduler tick completed")
+}
+
+func (s *SmsSchedulerImpl) checkpoint() (time.Time, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.tickInterval)
+	defer cancel()
+	return s.redisDao.GetCheckpoint(ctx, SCHEDULER_CHECKPOINT)
+}
+
+// processBucket releases the due entries of a bucket and, if advance is set, moves the checkpoint past the
+// bucket once it is empty. It reports whether the checkpoint was moved. The bucket's work has to be done
+// before its lease runs out and another replica may take the bucket over, so the lease ttl is its budget.
+func (s *SmsSchedulerImpl) processBucket(bucket time.Time, now time.Time, advance bool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.leaseTtl)
+	defer cancel()
+
+	s.releaseBucket(ctx, bucket, now)
+
+	if !advance {
+		return false
+	}
+	hasEntries, err := s.scyllaDao.HasScheduledSMS(ctx, bucket)
+	if err != nil || hasEntries {
+		return false
+	}
+	return s.redisDao.SetCheckpoint(ctx, SCHEDULER_CHECKPOINT, bucket.Add(s.bucketSize)) == nil
+}
+
+// releaseBucket hands every due entry of a bucket to the outbox relay, if this replica holds the bucket's lease.
+func (s *SmsSchedulerImpl) releaseBucket(ctx context.Context, bucket time.Time, now time.Time) {
+	logger := utils.ComponentLogger("scheduler")
+
+	leaseName := "scheduled_sms:" + bucket.Format(time.RFC3339)
+	acquired, err := s.redisDao.AcquireLease(ctx, leaseName, s.owner, s.leaseTtl)
+	if err != nil || !acquired {
+		return
+	}
+
+	entries, err := s.scyllaDao.GetDueScheduledSMS(ctx, bucket, now)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+
+	serviceInstance := repo.GetNotificationServiceInstance()
+	released := 0
+	for _, entry := range entries {
+		ok, err := serviceInstance.ReleaseScheduledSMSService(ctx, entry)
+		if err != nil {
+			// left in place, the next tick tries again.
+			logger.Error().
+				Err(err).
+				Str("request_id", entry.RequestId).
+				Msg("Failed to release scheduled SMS request")
+			continue
+		}
+		if ok {
+			released++
+		}
+	}
+
+	logger.Info().
+		Time("bucket", bucket).
+		Int("due", len(entries)).
+		Int("released", released).
+		Msg("Released due scheduled SMS requests")
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// api keys look like "<id>.<secret>". The id is not secret, it is how a key is looked up, listed
+// and referred to in logs; only a sha256 of the secret is ever stored.
+
+// GenerateAPIKey returns a new key id, its secret and the full key handed to the client.
+func GenerateAPIKey() (string, string, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := GenerateAPIKeySecret()
+	if err != nil {
+		return "", "", "", err
+	}
+	return id, secret, id + "." + secret, nil
+}
+
+func GenerateAPIKeySecret() (string, error) {
+	return randomHex(24)
+}
+
+// ParseAPIKey splits a key into its id and secret.
+func ParseAPIKey(key string) (string, string, bool) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func HashAPIKeySecret(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,11 @@
+package utils
+
+import "time"
+
+// DurationOr returns value, or fallback when value is not set (zero or negative), for config durations with a default.
+func DurationOr(value, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
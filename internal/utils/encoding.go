@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"unicode/utf16"
+
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+// an sms carries 140 bytes: 160 GSM-7 septets or 70 UCS-2 code units. A message that does not fit is split
+// into parts, each losing 6 bytes to the concatenation header (UDH), so parts hold 153 septets or 67 code units.
+// A single character outside the GSM-7 alphabet turns the whole message into UCS-2.
+
+const (
+	ENCODING_GSM7 = "GSM-7"
+	ENCODING_UCS2 = "UCS-2"
+
+	GSM7_SINGLE_SEGMENT = 160
+	GSM7_MULTI_SEGMENT  = 153
+	UCS2_SINGLE_SEGMENT = 70
+	UCS2_MULTI_SEGMENT  = 67
+)
+
+// GSM 03.38 default alphabet (one septet each) and its extension table (escape + septet, two each).
+const (
+	gsm7BasicAlphabet = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7ExtensionAlphabet = "\f^{}\\[~]|€"
+)
+
+var gsm7Septets = buildGsm7Septets()
+
+func buildGsm7Septets() map[rune]int {
+	septets := make(map[rune]int)
+	for _, r := range gsm7BasicAlphabet {
+		septets[r] = 1
+	}
+	for _, r := range gsm7ExtensionAlphabet {
+		septets[r] = 2
+	}
+	return septets
+}
+
+// maxNonGsmCharacters caps how many of the characters forcing UCS-2 are reported back.
+const maxNonGsmCharacters = 10
+
+// CountSegments works out the encoding of message and how many billable parts it is sent as.
+func CountSegments(message string) models.SegmentBreakdown {
+	breakdown := models.SegmentBreakdown{Encoding: ENCODING_GSM7}
+	seen := make(map[rune]bool)
+	for _, r := range message {
+		if _, ok := gsm7Septets[r]; ok {
+			continue
+		}
+		breakdown.Encoding = ENCODING_UCS2
+		if !seen[r] && len(breakdown.NonGsmCharacters) < maxNonGsmCharacters {
+			breakdown.NonGsmCharacters = append(breakdown.NonGsmCharacters, string(r))
+		}
+		seen[r] = true
+	}
+
+	// size of every character in septets or utf-16 code units, emoji outside the BMP take two.
+	sizes := make([]int, 0, len(message))
+	for _, r := range message {
+		size := gsm7Septets[r]
+		if breakdown.Encoding == ENCODING_UCS2 {
+			size = utf16.RuneLen(r)
+		}
+		sizes = append(sizes, size)
+		breakdown.Units += size
+	}
+	breakdown.Characters = len(sizes)
+
+	single, multi := GSM7_SINGLE_SEGMENT, GSM7_MULTI_SEGMENT
+	if breakdown.Encoding == ENCODING_UCS2 {
+		single, multi = UCS2_SINGLE_SEGMENT, UCS2_MULTI_SEGMENT
+	}
+	if breakdown.Units <= single {
+		breakdown.UnitsPerSegment = single
+		if breakdown.Units > 0 {
+			breakdown.SegmentCount = 1
+		}
+		return breakdown
+	}
+
+	// an escaped GSM-7 character or a surrogate pair is never split across parts, so a part may end up short.
+	breakdown.UnitsPerSegment = multi
+	breakdown.SegmentCount = 1
+	used := 0
+	for _, size := range sizes {
+		if used+size > multi {
+			breakdown.SegmentCount++
+			used = 0
+		}
+		used += size
+	}
+	return breakdown
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkSegments counts the parts of message and compares them with what a gateway would bill.
+func checkSegments(t *testing.T, message string, encoding string, units int, segments int) {
+	t.Helper()
+	got := CountSegments(message)
+	if got.Encoding != encoding || got.Units != units || got.SegmentCount != segments {
+		t.Errorf("CountSegments(%d characters) = %s, %d units in %d parts, want %s, %d units in %d parts",
+			len([]rune(message)), got.Encoding, got.Units, got.SegmentCount, encoding, units, segments)
+	}
+}
+
+func TestCountSegmentsGsm7Boundaries(t *testing.T) {
+	checkSegments(t, "", ENCODING_GSM7, 0, 0)
+	checkSegments(t, strings.Repeat("a", 160), ENCODING_GSM7, 160, 1)
+	checkSegments(t, strings.Repeat("a", 161), ENCODING_GSM7, 161, 2)
+	checkSegments(t, strings.Repeat("a", 306), ENCODING_GSM7, 306, 2)
+	checkSegments(t, strings.Repeat("a", 307), ENCODING_GSM7, 307, 3)
+
+	if got := CountSegments(strings.Repeat("a", 161)).UnitsPerSegment; got != GSM7_MULTI_SEGMENT {
+		t.Errorf("units per part of a split message = %d, want %d", got, GSM7_MULTI_SEGMENT)
+	}
+}
+
+// characters of the extension table are sent as an escape and a septet.
+func TestCountSegmentsGsm7ExtensionCharacters(t *testing.T) {
+	checkSegments(t, gsm7ExtensionAlphabet, ENCODING_GSM7, 20, 1)
+	checkSegments(t, strings.Repeat("€", 80), ENCODING_GSM7, 160, 1)
+	checkSegments(t, strings.Repeat("a", 159)+"{", ENCODING_GSM7, 161, 2)
+	// the escape and its septet stay in one part, so the first part closes at 152 septets.
+	checkSegments(t, strings.Repeat("a", 152)+"€"+strings.Repeat("a", 152), ENCODING_GSM7, 306, 3)
+}
+
+func TestCountSegmentsUcs2Boundaries(t *testing.T) {
+	checkSegments(t, strings.Repeat("अ", 70), ENCODING_UCS2, 70, 1)
+	checkSegments(t, strings.Repeat("अ", 71), ENCODING_UCS2, 71, 2)
+	// a single character outside GSM-7 moves the whole message to the smaller UCS-2 parts.
+	checkSegments(t, strings.Repeat("a", 70)+"अ", ENCODING_UCS2, 71, 2)
+	// and extension characters no longer need an escape.
+	checkSegments(t, strings.Repeat("€", 69)+"अ", ENCODING_UCS2, 70, 1)
+}
+
+// emoji outside the basic multilingual plane take a surrogate pair, which is never split across parts.
+func TestCountSegmentsSurrogatePairs(t *testing.T) {
+	checkSegments(t, strings.Repeat("😀", 35), ENCODING_UCS2, 70, 1)
+	checkSegments(t, strings.Repeat("a", 66)+"😀"+strings.Repeat("a", 66), ENCODING_UCS2, 134, 3)
+}
+
+func TestCountSegmentsReportsNonGsmCharacters(t *testing.T) {
+	got := CountSegments("Привет, Привет")
+	if want := []string{"П", "р", "и", "в", "е", "т"}; !slices.Equal(got.NonGsmCharacters, want) {
+		t.Errorf("non gsm characters = %q, want each listed once %q", got.NonGsmCharacters, want)
+	}
+	if got.Characters != 14 {
+		t.Errorf("characters = %d, want 14", got.Characters)
+	}
+
+	got = CountSegments("αβγδεζηθικλμνξο")
+	if len(got.NonGsmCharacters) != maxNonGsmCharacters {
+		t.Errorf("non gsm characters = %q, want the first %d", got.NonGsmCharacters, maxNonGsmCharacters)
+	}
+
+	if got := CountSegments("Your order has shipped"); got.NonGsmCharacters != nil {
+		t.Errorf("non gsm characters of a GSM-7 message = %q, want none", got.NonGsmCharacters)
+	}
+}
@@ -5,23 +5,63 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
 
-const traceIDKey contextKey = "trace_id"
+const (
+	traceIDKey     contextKey = "trace_id"
+	clientIDKey    contextKey = "client_id"
+	clientOwnerKey contextKey = "client_owner"
+	tenantIDKey    contextKey = "tenant_id"
+)
 
-// GetTraceID extracts trace ID from context
+// GetTraceID extracts trace ID from context, the one of the current span when there is one.
 func GetTraceID(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
 	if traceID, ok := ctx.Value(traceIDKey).(string); ok {
 		return traceID
 	}
 	return ""
 }
 
+// WithClient puts the authenticated api client on the context, so every log line of the request names it.
+func WithClient(ctx context.Context, clientID, owner string) context.Context {
+	ctx = context.WithValue(ctx, clientIDKey, clientID)
+	return context.WithValue(ctx, clientOwnerKey, owner)
+}
+
+// GetClient returns the api client and its owner put on the context by WithClient.
+func GetClient(ctx context.Context) (string, string) {
+	clientID, _ := ctx.Value(clientIDKey).(string)
+	owner, _ := ctx.Value(clientOwnerKey).(string)
+	return clientID, owner
+}
+
+// WithTenant puts the tenant a request or message belongs to on the context.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+// GetTenant returns the tenant put on the context by WithTenant, empty when there is none.
+func GetTenant(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantIDKey).(string)
+	return tenantID
+}
+
 // LogWithContext returns a logger with trace ID from context
 func LogWithContext(ctx context.Context) zerolog.Logger {
-	return zerolog.Ctx(ctx).With().Str("trace_id", GetTraceID(ctx)).Logger()
+	logger := zerolog.Ctx(ctx).With().Str("trace_id", GetTraceID(ctx))
+	if tenantID := GetTenant(ctx); tenantID != "" {
+		logger = logger.Str("tenant_id", tenantID)
+	}
+	if clientID, owner := GetClient(ctx); clientID != "" {
+		logger = logger.Str("client_id", clientID).Str("client_owner", owner)
+	}
+	return logger.Logger()
 }
 
 // ComponentLogger returns a logger for a specific component
@@ -47,6 +87,13 @@ func RequestLogger(ctx context.Context, component, operation string) zerolog.Log
 		logger = logger.Str("trace_id", traceID)
 	}
 
+	if tenantID := GetTenant(ctx); tenantID != "" {
+		logger = logger.Str("tenant_id", tenantID)
+	}
+	if clientID, owner := GetClient(ctx); clientID != "" {
+		logger = logger.Str("client_id", clientID).Str("client_owner", owner)
+	}
+
 	return logger.Logger()
 }
 
@@ -65,6 +112,10 @@ func DatabaseLogger(ctx context.Context, operation, table, requestID string) zer
 		logger = logger.Str("trace_id", traceID)
 	}
 
+	if tenantID := GetTenant(ctx); tenantID != "" {
+		logger = logger.Str("tenant_id", tenantID)
+	}
+
 	return logger.Logger()
 }
 
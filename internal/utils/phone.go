@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// phone numbers are stored, blacklisted and rate limited in E.164 ("+919876543210"), so
+// "9876543210", "09876543210" and "+91 98765 43210" all end up as the same number.
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// NormalizePhoneNumber parses number, reading numbers without a country code as numbers of
+// defaultRegion (an ISO 3166 code such as "IN"), and returns it in E.164.
+func NormalizePhoneNumber(number string, defaultRegion string) (string, error) {
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return "", errors.New("phone number is required")
+	}
+	parsed, err := phonenumbers.Parse(number, strings.ToUpper(defaultRegion))
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return phonenumbers.Format(parsed, phonenumbers.E164), nil
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholders are written as {{name}}, names are letters, digits and underscores.
+var placeholderPattern = regexp.MustCompile(`{{\s*([A-Za-z0-9_]+)\s*}}`)
+
+// TemplateParamsError lists the placeholders a render call did not fill and the params it did not need.
+type TemplateParamsError struct {
+	Missing []string
+	Extra   []string
+}
+
+func (e *TemplateParamsError) Error() string {
+	parts := []string{}
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing params: %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Extra) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown params: %s", strings.Join(e.Extra, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ExtractPlaceholders returns the distinct placeholder names of a template body, sorted.
+func ExtractPlaceholders(body string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderTemplate substitutes params into body. Every placeholder must be given and every param must be used.
+func RenderTemplate(body string, params map[string]string) (string, error) {
+	placeholders := ExtractPlaceholders(body)
+
+	paramsErr := &TemplateParamsError{}
+	expected := map[string]bool{}
+	for _, name := range placeholders {
+		expected[name] = true
+		if _, ok := params[name]; !ok {
+			paramsErr.Missing = append(paramsErr.Missing, name)
+		}
+	}
+	for name := range params {
+		if !expected[name] {
+			paramsErr.Extra = append(paramsErr.Extra, name)
+		}
+	}
+	if len(paramsErr.Missing) > 0 || len(paramsErr.Extra) > 0 {
+		sort.Strings(paramsErr.Extra)
+		return "", paramsErr
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(body, func(placeholder string) string {
+		return params[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
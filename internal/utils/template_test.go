@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestExtractPlaceholders(t *testing.T) {
+	got := ExtractPlaceholders("{{order_id}} for {{ name }}: {{order_id}} ships {{date}}, not {name} or {{bad-name}}")
+	want := []string{"date", "name", "order_id"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExtractPlaceholders() = %q, want %q", got, want)
+	}
+
+	if got := ExtractPlaceholders("Your order has shipped"); len(got) != 0 {
+		t.Errorf("ExtractPlaceholders() without placeholders = %q, want none", got)
+	}
+}
+
+func TestRenderTemplateFillsEveryPlaceholder(t *testing.T) {
+	got, err := RenderTemplate("Hi {{name}}, {{ code }} is your code. Do not share {{code}}.", map[string]string{
+		"name": "Asha",
+		"code": "4821",
+	})
+	if err != nil {
+		t.Fatalf("RenderTemplate() error = %v", err)
+	}
+	if want := "Hi Asha, 4821 is your code. Do not share 4821."; got != want {
+		t.Errorf("RenderTemplate() = %q, want %q", got, want)
+	}
+}
+
+// a param value is inserted as it is, even when it looks like a placeholder itself.
+func TestRenderTemplateDoesNotExpandParams(t *testing.T) {
+	got, err := RenderTemplate("Hi {{name}}, order {{order_id}}", map[string]string{
+		"name":     "{{order_id}}",
+		"order_id": "",
+	})
+	if err != nil {
+		t.Fatalf("RenderTemplate() error = %v", err)
+	}
+	if want := "Hi {{order_id}}, order "; got != want {
+		t.Errorf("RenderTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderTemplateRejectsMismatchedParams(t *testing.T) {
+	got, err := RenderTemplate("Hi {{name}}, order {{order_id}} arrives {{date}}", map[string]string{
+		"nmae":     "Asha",
+		"order_id": "42",
+		"city":     "Pune",
+	})
+	if got != "" {
+		t.Errorf("RenderTemplate() = %q, want no message when params do not match", got)
+	}
+
+	var paramsErr *TemplateParamsError
+	if !errors.As(err, &paramsErr) {
+		t.Fatalf("RenderTemplate() error = %v, want a *TemplateParamsError", err)
+	}
+	if want := []string{"date", "name"}; !slices.Equal(paramsErr.Missing, want) {
+		t.Errorf("missing params = %q, want %q", paramsErr.Missing, want)
+	}
+	if want := []string{"city", "nmae"}; !slices.Equal(paramsErr.Extra, want) {
+		t.Errorf("extra params = %q, want %q", paramsErr.Extra, want)
+	}
+	if want := "missing params: date, name; unknown params: city, nmae"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,448 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// the consumer of a topic is one poll loop and a pool of workers. The poll loop owns the kafka consumer: it reads
+// messages, hands each one to the worker its key hashes to, so one recipient's messages are processed one after the
+// other in the order they were produced, and commits offsets. A partition's offset only moves past a message once the
+// message reached its final outcome, handled, retried or dead-lettered, together with every message before it on the
+// partition. A crash never skips a message, it can only have some processed again, which the status checks of the
+// service turn into no-ops.
+// When partitions are revoked in a rebalance, their messages no worker started on are dropped, the ones in hand are
+// finished and the offsets are committed before the partitions are given up, so the next owner starts right after
+// the last message done here.
+
+// defaults of kafka.consumer in the config.
+const (
+	DEFAULT_CONSUMER_WORKERS         = 8
+	DEFAULT_CONSUMER_COMMIT_INTERVAL = 5 * time.Second
+	DEFAULT_CONSUMER_REVOKE_TIMEOUT  = 15 * time.Second
+)
+
+// partitionOffsets tracks the messages of an assigned partition that were read but are not committed yet.
+// Only the poll loop touches it, except for revoked, which workers wait on.
+type partitionOffsets struct {
+	pending   []kafka.Offset        // offsets read and not committable yet, in the order they were read
+	done      map[kafka.Offset]bool // pending offsets whose message is done
+	next      kafka.Offset          // offset to commit, right after the last message done in order
+	committed kafka.Offset          // offset last committed
+	inFlight  int                   // messages handed to workers and not reported back yet
+	revoked   chan struct{}         // closed once the partition is revoked
+}
+
+func newPartitionOffsets() *partitionOffsets {
+	return &partitionOffsets{
+		done:      make(map[kafka.Offset]bool),
+		next:      kafka.OffsetInvalid,
+		committed: kafka.OffsetInvalid,
+		revoked:   make(chan struct{}),
+	}
+}
+
+// advance moves next past the done messages at the head of pending.
+func (p *partitionOffsets) advance() {
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		delete(p.done, p.pending[0])
+		p.next = p.pending[0] + 1
+		p.pending = p.pending[1:]
+	}
+}
+
+func (p *partitionOffsets) isRevoked() bool {
+	select {
+	case <-p.revoked:
+		return true
+	default:
+		return false
+	}
+}
+
+type consumeJob struct {
+	msg       *kafka.Message
+	partition *partitionOffsets
+	done      bool // set by the worker once the message reached its final outcome
+}
+
+type topicConsumer struct {
+	dao            *KafkaDaoImpl
+	consumer       *kafka.Consumer
+	topic          string
+	delay          time.Duration               // how long a message waits after it was produced, for retry tiers
+	workers        []chan *consumeJob          // one queue per worker
+	finished       chan *consumeJob            // jobs the workers are done with, back to the poll loop
+	partitions     map[int32]*partitionOffsets // assigned partitions
+	inFlight       int                         // jobs handed to workers and not reported back yet
+	maxInFlight    int
+	paused         bool // reading is paused until the workers catch up
+	nextWorker     int  // worker of the next message without a key
+	commitInterval time.Duration
+	revokeTimeout  time.Duration
+	workersDone    sync.WaitGroup
+}
+
+func (c *KafkaDaoImpl) newTopicConsumer(consumer *kafka.Consumer, topic string, delay time.Duration) *topicConsumer {
+	t := &topicConsumer{
+		dao:            c,
+		consumer:       consumer,
+		topic:          topic,
+		delay:          delay,
+		workers:        make([]chan *consumeJob, c.consumerWorkers),
+		finished:       make(chan *consumeJob, c.maxInFlight),
+		partitions:     make(map[int32]*partitionOffsets),
+		maxInFlight:    c.maxInFlight,
+		commitInterval: c.commitInterval,
+		revokeTimeout:  c.revokeTimeout,
+	}
+	for i := range t.workers {
+		t.workers[i] = make(chan *consumeJob, c.maxInFlight)
+	}
+	return t
+}
+
+// run is the poll loop of the topic, it returns once the consumer is stopped and closed.
+func (t *topicConsumer) run() {
+	defer t.dao.consumers.Done()
+	logger := utils.KafkaLogger("consume", t.topic)
+
+	err := t.consumer.SubscribeTopics([]string{t.topic}, t.rebalance)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to subscribe to topic")
+		closeConsumer(t.consumer, t.topic)
+		return
+	}
+
+	for _, jobs := range t.workers {
+		t.workersDone.Add(1)
+		go t.work(jobs)
+	}
+	logger.Info().
+		Dur("retry_delay", t.delay).
+		Int("workers", len(t.workers)).
+		Int("max_in_flight", t.maxInFlight).
+		Msg("Kafka consumer started and subscribed to topic")
+
+	commitTicker := time.NewTicker(t.commitInterval)
+	defer commitTicker.Stop()
+	for {
+		select {
+		case <-t.dao.stop:
+			logger.Info().Msg("Stopping Kafka consumer")
+			t.shutdown()
+			return
+		case <-commitTicker.C:
+			t.commit(nil)
+		default:
+		}
+
+		t.collectFinished()
+		t.throttle()
+
+		switch ev := t.consumer.Poll(int(CONSUMER_POLL_INTERVAL.Milliseconds())).(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				logger.Error().
+					Err(ev.TopicPartition.Error).
+					Int32("partition", ev.TopicPartition.Partition).
+					Msg("Error reading message from Kafka")
+				continue
+			}
+			t.dispatch(ev)
+		case kafka.Error:
+			logger.Error().
+				Err(ev).
+				Msg("Error reading message from Kafka")
+		}
+	}
+}
+
+// dispatch queues a message on the worker of its key. Messages without a key are spread over the workers.
+func (t *topicConsumer) dispatch(msg *kafka.Message) {
+	logger := utils.KafkaLogger("consume", t.topic)
+	logger.Debug().
+		Int32("partition", msg.TopicPartition.Partition).
+		Int64("offset", int64(msg.TopicPartition.Offset)).
+		Int("message_size", len(msg.Value)).
+		Msg("Received message from Kafka")
+	recordConsumerLag(t.consumer, msg)
+
+	partition, ok := t.partitions[msg.TopicPartition.Partition]
+	if !ok {
+		partition = newPartitionOffsets()
+		t.partitions[msg.TopicPartition.Partition] = partition
+	}
+	partition.pending = append(partition.pending, msg.TopicPartition.Offset)
+	partition.inFlight++
+	t.inFlight++
+
+	worker := t.nextWorker
+	if len(msg.Key) > 0 {
+		hash := fnv.New32a()
+		_, _ = hash.Write(msg.Key)
+		worker = int(hash.Sum32() % uint32(len(t.workers)))
+	} else {
+		t.nextWorker = (t.nextWorker + 1) % len(t.workers)
+	}
+
+	// a full worker queue must not keep the workers from reporting back, or neither side could move on.
+	job := &consumeJob{msg: msg, partition: partition}
+	for {
+		select {
+		case t.workers[worker] <- job:
+			return
+		case finished := <-t.finished:
+			t.complete(finished)
+		}
+	}
+}
+
+// work processes the jobs of one worker queue, in order, until the queue is closed.
+func (t *topicConsumer) work(jobs <-chan *consumeJob) {
+	defer t.workersDone.Done()
+	for job := range jobs {
+		job.done = t.process(job)
+		t.finished <- job
+	}
+}
+
+// process handles a job and reports whether its message is done. A message of a revoked partition, or one still
+// queued when the consumer stops, is left alone, whoever owns the partition next reads it again.
+func (t *topicConsumer) process(job *consumeJob) bool {
+	logger := utils.KafkaLogger("consume", t.topic)
+	if job.partition.isRevoked() {
+		return false
+	}
+	select {
+	case <-t.dao.stop:
+		return false
+	default:
+	}
+
+	// every message on a retry tier carries the same delay, so waiting never holds back a message that is already due.
+	if t.delay > 0 {
+		if wait := time.Until(retryAt(job.msg)); wait > 0 {
+			logger.Debug().
+				Dur("wait", wait).
+				Msg("Waiting for retry message to become due")
+			select {
+			case <-time.After(wait):
+			case <-t.dao.stop:
+				return false
+			case <-job.partition.revoked:
+				return false
+			}
+		}
+	}
+
+	// the message is handled once; only moving it to a retry or dead-letter topic is repeated, until the
+	// partition is revoked or the consumer stops, then the next owner reads the message again.
+	return t.dao.processMessage(job.msg, job.partition.revoked)
+}
+
+// collectFinished takes in the jobs the workers reported back since the last poll.
+func (t *topicConsumer) collectFinished() {
+	for {
+		select {
+		case job := <-t.finished:
+			t.complete(job)
+		default:
+			return
+		}
+	}
+}
+
+func (t *topicConsumer) complete(job *consumeJob) {
+	t.inFlight--
+	job.partition.inFlight--
+	if job.done {
+		job.partition.done[job.msg.TopicPartition.Offset] = true
+		job.partition.advance()
+	}
+}
+
+// throttle pauses reading while the workers have maxInFlight messages in hand and resumes once they got through half.
+func (t *topicConsumer) throttle() {
+	logger := utils.KafkaLogger("consume", t.topic)
+
+	switch {
+	case !t.paused && t.inFlight >= t.maxInFlight:
+		assignment, err := t.consumer.Assignment()
+		if err == nil {
+			err = t.consumer.Pause(assignment)
+		}
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("Failed to pause Kafka consumer")
+			return
+		}
+		t.paused = true
+		logger.Debug().
+			Int("in_flight", t.inFlight).
+			Msg("Paused Kafka consumer until the workers catch up")
+	case t.paused && t.inFlight <= t.maxInFlight/2:
+		assignment, err := t.consumer.Assignment()
+		if err == nil {
+			err = t.consumer.Resume(assignment)
+		}
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("Failed to resume Kafka consumer")
+			return
+		}
+		t.paused = false
+	}
+}
+
+// commit commits the offsets that moved since the last commit, of the given partitions or, for nil, of all of them.
+func (t *topicConsumer) commit(only []kafka.TopicPartition) {
+	logger := utils.KafkaLogger("commit", t.topic)
+
+	partitions := make([]int32, 0, len(t.partitions))
+	if only == nil {
+		for partition := range t.partitions {
+			partitions = append(partitions, partition)
+		}
+	} else {
+		for _, tp := range only {
+			partitions = append(partitions, tp.Partition)
+		}
+	}
+
+	offsets := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, partition := range partitions {
+		state, ok := t.partitions[partition]
+		if !ok || state.next <= state.committed {
+			continue
+		}
+		offsets = append(offsets, kafka.TopicPartition{Topic: &t.topic, Partition: partition, Offset: state.next})
+	}
+	if len(offsets) == 0 {
+		return
+	}
+
+	_, err := t.consumer.CommitOffsets(offsets)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("partitions", len(offsets)).
+			Msg("Failed to commit Kafka offsets")
+		return
+	}
+	for _, offset := range offsets {
+		t.partitions[offset.Partition].committed = offset.Offset
+	}
+}
+
+// rebalance is called from Poll when the group rebalances; the partitions are assigned or unassigned after it returns.
+func (t *topicConsumer) rebalance(consumer *kafka.Consumer, event kafka.Event) error {
+	logger := utils.KafkaLogger("rebalance", t.topic)
+
+	switch ev := event.(type) {
+	case kafka.AssignedPartitions:
+		for _, tp := range ev.Partitions {
+			t.partitions[tp.Partition] = newPartitionOffsets()
+		}
+		logger.Info().
+			Int("partitions", len(ev.Partitions)).
+			Msg("Kafka partitions assigned")
+	case kafka.RevokedPartitions:
+		t.revoke(ev.Partitions)
+		logger.Info().
+			Int("partitions", len(ev.Partitions)).
+			Bool("lost", consumer.AssignmentLost()).
+			Msg("Kafka partitions revoked")
+	}
+	return nil
+}
+
+// revoke gives up partitions: their queued messages are dropped, the ones in hand are waited for up to the
+// revoke timeout, and what is done is committed, unless the partitions were already lost to another consumer.
+func (t *topicConsumer) revoke(partitions []kafka.TopicPartition) {
+	logger := utils.KafkaLogger("rebalance", t.topic)
+
+	revoked := make([]*partitionOffsets, 0, len(partitions))
+	for _, tp := range partitions {
+		if state, ok := t.partitions[tp.Partition]; ok {
+			close(state.revoked)
+			revoked = append(revoked, state)
+		}
+	}
+
+	inFlight := func() int {
+		count := 0
+		for _, state := range revoked {
+			count += state.inFlight
+		}
+		return count
+	}
+	timeout := time.NewTimer(t.revokeTimeout)
+	defer timeout.Stop()
+	for inFlight() > 0 {
+		select {
+		case job := <-t.finished:
+			t.complete(job)
+			continue
+		case <-timeout.C:
+			logger.Warn().
+				Int("in_flight", inFlight()).
+				Msg("Gave up waiting for messages of revoked partitions, they may be processed again")
+		}
+		break
+	}
+
+	if !t.consumer.AssignmentLost() {
+		t.commit(partitions)
+	}
+	for _, tp := range partitions {
+		delete(t.partitions, tp.Partition)
+	}
+}
+
+// shutdown lets the workers finish the messages in hand, drops the queued ones, commits and leaves the group.
+func (t *topicConsumer) shutdown() {
+	for _, jobs := range t.workers {
+		close(jobs)
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		t.workersDone.Wait()
+		close(workersDone)
+	}()
+
+	for {
+		select {
+		case job := <-t.finished:
+			t.complete(job)
+			continue
+		case <-workersDone:
+		}
+		break
+	}
+	t.collectFinished()
+	t.commit(nil)
+	closeConsumer(t.consumer, t.topic)
+}
+
+// closeConsumer leaves the consumer group, the offsets were committed by the poll loop.
+func closeConsumer(consumer *kafka.Consumer, topic string) {
+	logger := utils.KafkaLogger("close", topic)
+
+	err := consumer.Close()
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to close Kafka consumer")
+		return
+	}
+	logger.Info().Msg("Kafka consumer closed")
+}
@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// read books messages at offsets of partition in as the poll loop does when it dispatches them,
+// and returns their jobs so the test can finish them in any order.
+func read(t *topicConsumer, partition int32, offsets ...kafka.Offset) map[kafka.Offset]*consumeJob {
+	state, ok := t.partitions[partition]
+	if !ok {
+		state = newPartitionOffsets()
+		t.partitions[partition] = state
+	}
+	jobs := make(map[kafka.Offset]*consumeJob, len(offsets))
+	for _, offset := range offsets {
+		state.pending = append(state.pending, offset)
+		state.inFlight++
+		t.inFlight++
+		jobs[offset] = &consumeJob{
+			msg:       &kafka.Message{TopicPartition: kafka.TopicPartition{Partition: partition, Offset: offset}},
+			partition: state,
+		}
+	}
+	return jobs
+}
+
+// finish reports a job back from its worker, done tells whether its message reached its final outcome.
+func finish(t *topicConsumer, job *consumeJob, done bool) {
+	job.done = done
+	t.complete(job)
+}
+
+func newTestTopicConsumer() *topicConsumer {
+	return &topicConsumer{partitions: make(map[int32]*partitionOffsets)}
+}
+
+func TestCommitOffsetWaitsForEarlierMessages(t *testing.T) {
+	consumer := newTestTopicConsumer()
+	jobs := read(consumer, 0, 10, 11, 12, 13)
+	partition := consumer.partitions[0]
+
+	// workers of other keys got through later messages first.
+	finish(consumer, jobs[12], true)
+	finish(consumer, jobs[11], true)
+	if partition.next != kafka.OffsetInvalid {
+		t.Fatalf("next = %v while offset 10 is in hand, want nothing to commit", partition.next)
+	}
+
+	finish(consumer, jobs[10], true)
+	if partition.next != 13 {
+		t.Fatalf("next = %v once 10 to 12 finished, want 13", partition.next)
+	}
+
+	finish(consumer, jobs[13], true)
+	if partition.next != 14 {
+		t.Errorf("next = %v once every message finished, want 14", partition.next)
+	}
+	if len(partition.pending) != 0 || len(partition.done) != 0 {
+		t.Errorf("pending = %v, done = %v once every message finished, want both empty", partition.pending, partition.done)
+	}
+	if consumer.inFlight != 0 || partition.inFlight != 0 {
+		t.Errorf("in flight = %d, %d on the partition, want 0", consumer.inFlight, partition.inFlight)
+	}
+}
+
+// a message left alone, e.g. because its partition was revoked, is read again by the next owner,
+// so the offset never moves past it.
+func TestCommitOffsetHeldByMessageNotDone(t *testing.T) {
+	consumer := newTestTopicConsumer()
+	jobs := read(consumer, 0, 10, 11, 12)
+	partition := consumer.partitions[0]
+
+	finish(consumer, jobs[10], true)
+	finish(consumer, jobs[11], false)
+	finish(consumer, jobs[12], true)
+
+	if partition.next != 11 {
+		t.Errorf("next = %v, want 11, the message that was not done", partition.next)
+	}
+	if consumer.inFlight != 0 {
+		t.Errorf("in flight = %d, want 0, the workers reported every job back", consumer.inFlight)
+	}
+}
+
+// compaction and transaction markers leave holes in the offsets a consumer reads.
+func TestCommitOffsetAcrossOffsetHoles(t *testing.T) {
+	consumer := newTestTopicConsumer()
+	jobs := read(consumer, 0, 10, 15, 20)
+	partition := consumer.partitions[0]
+
+	finish(consumer, jobs[15], true)
+	finish(consumer, jobs[10], true)
+	if partition.next != 16 {
+		t.Fatalf("next = %v, want 16", partition.next)
+	}
+	finish(consumer, jobs[20], true)
+	if partition.next != 21 {
+		t.Errorf("next = %v, want 21", partition.next)
+	}
+}
+
+func TestCommitOffsetPerPartition(t *testing.T) {
+	consumer := newTestTopicConsumer()
+	first := read(consumer, 0, 10, 11)
+	second := read(consumer, 1, 50, 51)
+
+	finish(consumer, first[11], true)
+	finish(consumer, second[50], true)
+	finish(consumer, second[51], true)
+
+	if next := consumer.partitions[0].next; next != kafka.OffsetInvalid {
+		t.Errorf("partition 0 next = %v, want nothing to commit while offset 10 is in hand", next)
+	}
+	if next := consumer.partitions[1].next; next != 52 {
+		t.Errorf("partition 1 next = %v, want 52", next)
+	}
+	if consumer.inFlight != 1 {
+		t.Errorf("in flight = %d, want 1", consumer.inFlight)
+	}
+}
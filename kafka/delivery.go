@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/repo"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// a request is only Queued once the broker stored its message. ProduceBatch waits for the broker's delivery
+// report of every message it produced and records it before returning.
+
+var ErrDeliveryTimeout = errors.New("timed out waiting for kafka delivery report")
+
+// deliveryTag is the opaque of a produced request message, it tells the delivery report which request,
+// and which message of a batch, it is about.
+type deliveryTag struct {
+	requestId string
+	index     int
+}
+
+// recordDelivery handles the delivery report of a request message and returns its delivery error. Once the broker
+// stored the message, the request is moved to Queued with the partition and offset it got.
+func (p *KafkaDaoImpl) recordDelivery(ctx context.Context, msg *kafka.Message) error {
+	topic := *msg.TopicPartition.Topic
+	logger := utils.KafkaLogger("delivery_report", topic)
+	tag := msg.Opaque.(*deliveryTag)
+
+	if err := msg.TopicPartition.Error; err != nil {
+		metrics.IncKafkaProduced(topic, metrics.KAFKA_RESULT_ERROR)
+		logger.Error().
+			Err(err).
+			Str("request_id", tag.requestId).
+			Msg("Failed to deliver SMS request to Kafka")
+		return err
+	}
+
+	metrics.IncKafkaProduced(topic, metrics.KAFKA_RESULT_OK)
+	err := repo.GetNotificationServiceInstance().MarkSMSQueuedService(ctx, tag.requestId, msg.TopicPartition.Partition, int64(msg.TopicPartition.Offset))
+	if err != nil {
+		// the message is on kafka and will be sent, only its row lags behind.
+		logger.Error().
+			Err(err).
+			Str("request_id", tag.requestId).
+			Int32("partition", msg.TopicPartition.Partition).
+			Int64("offset", int64(msg.TopicPartition.Offset)).
+			Msg("Message delivered but failed to mark SMS request Queued")
+	}
+	return nil
+}
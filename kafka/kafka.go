@@ -3,24 +3,42 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/channels"
 	"github.com/padam-meesho/NotificationService/config"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
 	"github.com/padam-meesho/NotificationService/internal/models"
 	"github.com/padam-meesho/NotificationService/internal/repo"
 	"github.com/padam-meesho/NotificationService/internal/utils"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type KafkaDao interface {
-	Produce(payload models.KafkaPayload) error
+	ProduceBatch(ctx context.Context, payloads []models.KafkaPayload) []error
 	Consume()
+	StopConsumers(ctx context.Context) error
+	Close(ctx context.Context) error
 }
 
 type KafkaDaoImpl struct {
-	producer *kafka.Producer
-	consumer *kafka.Consumer
+	producer        *kafka.Producer
+	consumer        *kafka.Consumer
+	retryConsumers  map[string]*kafka.Consumer
+	retryTiers      []models.KafkaRetryTier
+	maxAttempts     int
+	dlqTopic        string
+	deliveryTimeout time.Duration // longest a produce call waits for the broker's acknowledgement
+	consumerWorkers int           // workers per consumed topic
+	maxInFlight     int           // messages per consumed topic read but not done before reading pauses
+	commitInterval  time.Duration
+	revokeTimeout   time.Duration
+	stop            chan struct{} // closed to end the consumer loops
+	stopOnce        sync.Once
+	consumers       sync.WaitGroup // consumer loops still running
 }
 
 var (
@@ -29,6 +47,9 @@ var (
 	KAFKA_TOPIC_NAME string = "notification.send_sms"
 )
 
+// CONSUMER_POLL_INTERVAL is the longest a consumer loop blocks on a read before it checks whether it should stop.
+const CONSUMER_POLL_INTERVAL = time.Second
+
 func NewKafkaDao(appConfig *models.AppConfig) *KafkaDaoImpl {
 	logger := utils.ComponentLogger("kafka")
 
@@ -37,11 +58,46 @@ func NewKafkaDao(appConfig *models.AppConfig) *KafkaDaoImpl {
 		if kafkaConfig == nil {
 			logger.Fatal().Msg("Kafka client not initialized during DAO creation")
 		}
+		retryConfig := appConfig.Kafka.Retry
+		maxAttempts := retryConfig.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = len(retryConfig.Tiers) + 1
+		}
+		deliveryTimeout := appConfig.Kafka.Producer.DeliveryTimeout
+		if deliveryTimeout <= 0 {
+			deliveryTimeout = config.DEFAULT_KAFKA_DELIVERY_TIMEOUT
+		}
+		consumerConfig := appConfig.Kafka.Consumer
+		workers := consumerConfig.Workers
+		if workers <= 0 {
+			workers = DEFAULT_CONSUMER_WORKERS
+		}
+		maxInFlight := consumerConfig.MaxInFlight
+		if maxInFlight < workers {
+			maxInFlight = 10 * workers
+		}
 		kafkaInstance = &KafkaDaoImpl{
-			producer: kafkaConfig.KafkaProducer,
-			consumer: kafkaConfig.KafkaConsumer,
+			producer:        kafkaConfig.KafkaProducer,
+			consumer:        kafkaConfig.KafkaConsumer,
+			retryConsumers:  kafkaConfig.KafkaRetryConsumers,
+			retryTiers:      retryConfig.Tiers,
+			maxAttempts:     maxAttempts,
+			dlqTopic:        retryConfig.DlqTopic,
+			deliveryTimeout: deliveryTimeout,
+			consumerWorkers: workers,
+			maxInFlight:     maxInFlight,
+			commitInterval:  utils.DurationOr(consumerConfig.CommitInterval, DEFAULT_CONSUMER_COMMIT_INTERVAL),
+			revokeTimeout:   utils.DurationOr(consumerConfig.RevokeTimeout, DEFAULT_CONSUMER_REVOKE_TIMEOUT),
+			stop:            make(chan struct{}),
 		}
-		logger.Info().Msg("Kafka DAO initialized successfully")
+		logger.Info().
+			Int("retry_tiers", len(retryConfig.Tiers)).
+			Int("max_attempts", maxAttempts).
+			Str("dlq_topic", retryConfig.DlqTopic).
+			Dur("delivery_timeout", deliveryTimeout).
+			Int("consumer_workers", workers).
+			Int("max_in_flight", maxInFlight).
+			Msg("Kafka DAO initialized successfully")
 	})
 	return kafkaInstance
 }
@@ -50,115 +106,274 @@ func GetKafkaDao() *KafkaDaoImpl {
 	return kafkaInstance
 }
 
-func (p *KafkaDaoImpl) Produce(payload models.KafkaPayload) error {
-	logger := utils.KafkaLogger("produce", KAFKA_TOPIC_NAME)
-
-	marshalledPayload, err := json.Marshal(&payload)
+// NewRequestPayload wraps a request id in the envelope the consumer expects,
+// typed with the payload type of the request's channel, tagged with its tenant and keyed by its recipient.
+func NewRequestPayload(channelName string, tenantId string, reqId string, phoneNumber string) (models.KafkaPayload, error) {
+	channel, err := channels.GetChannel(channelName)
 	if err != nil {
-		logger.Error().
-			Err(err).
-			Str("payload_type", payload.Type).
-			Msg("Failed to marshal Kafka payload")
-		return err
+		return models.KafkaPayload{}, err
+	}
+	smsPayloadBytes, err := json.Marshal(models.SendSmsPayload{
+		MessageId: reqId,
+	})
+	if err != nil {
+		return models.KafkaPayload{}, err
 	}
+	return models.KafkaPayload{
+		Type:      channel.PayloadType(),
+		TenantID:  tenantId,
+		Data:      smsPayloadBytes,
+		RequestId: reqId,
+		Key:       phoneNumber,
+	}, nil
+}
 
-	logger.Info().
-		Str("payload_type", payload.Type).
-		Int("payload_size", len(marshalledPayload)).
-		Msg("Attempting to produce message")
-
-	err = p.producer.Produce(&kafka.Message{
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &KAFKA_TOPIC_NAME,
-			Partition: kafka.PartitionAny,
-		},
-		Value: marshalledPayload,
-	}, nil)
+// messageKey is the key a payload is produced with, none for a payload without a recipient,
+// the producer then spreads such messages over the partitions.
+func messageKey(payload models.KafkaPayload) []byte {
+	if payload.Key == "" {
+		return nil
+	}
+	return []byte(payload.Key)
+}
 
-	if err != nil {
-		logger.Error().
-			Err(err).
-			Str("payload_type", payload.Type).
-			Msg("Failed to produce message to Kafka")
-		return err
+// ProduceBatch hands all payloads to the producer without waiting in between and then collects the broker's
+// delivery reports, marking the delivered requests Queued: the outbox relay only drops entries that were
+// acknowledged. The returned slice has the outcome of each payload, in order.
+// The messages carry the trace of ctx, under one producer span, unless a payload brings its own trace.
+func (p *KafkaDaoImpl) ProduceBatch(ctx context.Context, payloads []models.KafkaPayload) []error {
+	logger := utils.KafkaLogger("produce_batch", KAFKA_TOPIC_NAME)
+	span, headers := startProduceSpan(ctx, KAFKA_TOPIC_NAME, len(payloads))
+	defer span.End()
+
+	results := make([]error, len(payloads))
+	deliveryChan := make(chan kafka.Event, len(payloads))
+	outstanding := make(map[int]bool, len(payloads))
+
+	for i, payload := range payloads {
+		marshalledPayload, err := json.Marshal(&payload)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		err = p.producer.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &KAFKA_TOPIC_NAME,
+				Partition: kafka.PartitionAny,
+			},
+			Key:     messageKey(payload),
+			Value:   marshalledPayload,
+			Headers: payloadTraceHeaders(ctx, payload, headers),
+			Opaque:  &deliveryTag{requestId: payload.RequestId, index: i},
+		}, deliveryChan)
+		if err != nil {
+			metrics.IncKafkaProduced(KAFKA_TOPIC_NAME, metrics.KAFKA_RESULT_ERROR)
+			results[i] = err
+			continue
+		}
+		outstanding[i] = true
+	}
+
+	timeout := time.After(p.deliveryTimeout)
+	for len(outstanding) > 0 {
+		select {
+		case event := <-deliveryChan:
+			msg, ok := event.(*kafka.Message)
+			if !ok {
+				continue
+			}
+			i := msg.Opaque.(*deliveryTag).index
+			delete(outstanding, i)
+			results[i] = p.recordDelivery(ctx, msg)
+		case <-timeout:
+			// whatever is still outstanding is reported as failed, it may still be delivered later.
+			logger.Error().
+				Int("outstanding", len(outstanding)).
+				Msg("Timed out waiting for Kafka delivery reports")
+			metrics.IncKafkaProducedBy(KAFKA_TOPIC_NAME, metrics.KAFKA_RESULT_ERROR, len(outstanding))
+			for i := range outstanding {
+				results[i] = ErrDeliveryTimeout
+				delete(outstanding, i)
+			}
+		}
 	}
 
+	failed := 0
+	for _, payloadErr := range results {
+		if payloadErr != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d messages failed", failed, len(payloads)))
+	}
 	logger.Info().
-		Str("payload_type", payload.Type).
-		Msg("Message successfully sent to Kafka")
-	return nil
+		Int("count", len(payloads)).
+		Int("failed", failed).
+		Msg("Produced message batch to Kafka")
+	return results
 }
 
+// Consume starts the consumer loops of the main topic and of every retry tier in the background,
+// they run until StopConsumers is called.
 func (c *KafkaDaoImpl) Consume() {
-	logger := utils.KafkaLogger("consume", KAFKA_TOPIC_NAME)
-	defer c.consumer.Close()
+	for _, tier := range c.retryTiers {
+		retryConsumer, ok := c.retryConsumers[tier.Topic]
+		if !ok {
+			continue
+		}
+		c.consumers.Add(1)
+		go c.newTopicConsumer(retryConsumer, tier.Topic, tier.Delay).run()
+	}
+	c.consumers.Add(1)
+	go c.newTopicConsumer(c.consumer, KAFKA_TOPIC_NAME, 0).run()
+}
 
-	c.consumer.SubscribeTopics([]string{KAFKA_TOPIC_NAME}, nil)
-	serviceInstance := repo.GetNotificationServiceInstance()
+// StopConsumers ends the consumer loops and waits for their workers to finish the messages in hand, commit the
+// offsets of the messages done and leave the group. Messages read but not processed yet are consumed again by
+// whoever takes the partition over.
+func (c *KafkaDaoImpl) StopConsumers(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	logger.Info().Msg("Kafka consumer started and subscribed to topic")
+// Close waits for the producer to deliver the messages still queued, until ctx is done, and closes it.
+func (p *KafkaDaoImpl) Close(ctx context.Context) error {
+	logger := utils.KafkaLogger("close", KAFKA_TOPIC_NAME)
+	defer p.producer.Close()
 
 	for {
-		msg, err := c.consumer.ReadMessage(-1)
-		if err != nil {
+		outstanding := p.producer.Flush(100)
+		if outstanding == 0 {
+			logger.Info().Msg("Kafka producer flushed")
+			return nil
+		}
+		if ctx.Err() != nil {
 			logger.Error().
-				Err(err).
-				Msg("Error reading message from Kafka")
-			continue
+				Int("outstanding", outstanding).
+				Msg("Timed out flushing Kafka producer, undelivered messages are lost")
+			return fmt.Errorf("%d kafka messages not delivered: %w", outstanding, ctx.Err())
 		}
+	}
+}
 
-		logger.Info().
-			Int32("partition", msg.TopicPartition.Partition).
-			Int64("offset", int64(msg.TopicPartition.Offset)).
-			Int("message_size", len(msg.Value)).
-			Msg("Received message from Kafka")
+// processMessage handles a message and reports whether it reached a final outcome: handled, moved to a retry tier
+// or dead-lettered. The move to a retry or dead-letter topic is tried until it works or abort is closed; a message
+// that could not be moved is not done, its offset must not be committed.
+func (c *KafkaDaoImpl) processMessage(msg *kafka.Message, abort <-chan struct{}) bool {
+	traceCtx, span := startConsumeSpan(msg)
+	defer span.End()
+	logger := utils.KafkaLogger("consume", *msg.TopicPartition.Topic).With().
+		Str("trace_id", utils.GetTraceID(traceCtx)).
+		Logger()
+	serviceInstance := repo.GetNotificationServiceInstance()
+	attempt := attemptOf(msg)
+
+	var payload models.KafkaPayload
+	err := json.Unmarshal(msg.Value, &payload)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("raw_message", string(msg.Value)).
+			Msg("Failed to unmarshal Kafka payload")
+		return c.finishDeadLettered(msg, attempt, err, abort)
+	}
+
+	logger = logger.With().Str("tenant_id", payload.TenantID).Logger()
+	logger.Info().
+		Str("message_type", payload.Type).
+		Int("attempt", attempt).
+		Msg("Successfully parsed Kafka message")
+
+	// every channel shares the envelope and the service handling, the payload type only selects the channel.
+	channel, ok := channels.GetChannelByPayloadType(payload.Type)
+	if !ok {
+		logger.Warn().
+			Str("message_type", payload.Type).
+			Msg("Received unknown message type")
+		return c.finishDeadLettered(msg, attempt, fmt.Errorf("unknown message type %q", payload.Type), abort)
+	}
+
+	var sendSMSPayload models.SendSmsPayload
+	err = json.Unmarshal(payload.Data, &sendSMSPayload)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("raw_data", string(payload.Data)).
+			Msg("Failed to unmarshal SMS payload")
+		return c.finishDeadLettered(msg, attempt, err, abort)
+	}
 
-		var payload models.KafkaPayload
-		err = json.Unmarshal(msg.Value, &payload)
+	logger.Info().
+		Str("message_id", sendSMSPayload.MessageId).
+		Str("channel", channel.Name()).
+		Msg("Processing SMS request from Kafka")
+
+	ctx, cancel := context.WithTimeout(utils.WithTenant(traceCtx, payload.TenantID), 10*time.Second)
+	defer cancel()
+	err = serviceInstance.HandleKafkaMessages(ctx, sendSMSPayload.MessageId, attempt)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("message_id", sendSMSPayload.MessageId).
+			Int("attempt", attempt).
+			Msg("Failed to process SMS request")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "processing failed")
+		retried, moveErr := c.retry(msg, attempt, err, abort)
+		if moveErr != nil {
+			return false
+		}
+		if retried {
+			metrics.IncKafkaConsumed(*msg.TopicPartition.Topic, metrics.KAFKA_RESULT_RETRIED)
+			return true
+		}
+		metrics.IncKafkaConsumed(*msg.TopicPartition.Topic, metrics.KAFKA_RESULT_DEAD_LETTERED)
+		err = serviceInstance.HandleExhaustedRetries(ctx, sendSMSPayload.MessageId, attempt, err)
 		if err != nil {
 			logger.Error().
 				Err(err).
-				Str("raw_message", string(msg.Value)).
-				Msg("Failed to unmarshal Kafka payload")
-			continue
+				Str("message_id", sendSMSPayload.MessageId).
+				Msg("Failed to mark dead-lettered SMS request as failed")
 		}
+		return true
+	}
 
-		logger.Info().
-			Str("message_type", payload.Type).
-			Msg("Successfully parsed Kafka message")
-
-		switch payload.Type {
-		case "SMS_REQUEST":
-			var sendSMSPayload models.SendSmsPayload
-			err := json.Unmarshal(payload.Data, &sendSMSPayload)
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("raw_data", string(payload.Data)).
-					Msg("Failed to unmarshal SMS payload")
-				continue
-			}
+	metrics.IncKafkaConsumed(*msg.TopicPartition.Topic, metrics.KAFKA_RESULT_OK)
+	logger.Info().
+		Str("message_id", sendSMSPayload.MessageId).
+		Msg("Successfully processed SMS request")
+	return true
+}
 
-			logger.Info().
-				Str("message_id", sendSMSPayload.MessageId).
-				Msg("Processing SMS request from Kafka")
-
-			ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-			err = serviceInstance.HandleKafkaMessages(ctx, sendSMSPayload.MessageId)
-			if err != nil {
-				logger.Error().
-					Err(err).
-					Str("message_id", sendSMSPayload.MessageId).
-					Msg("Failed to process SMS request")
-			} else {
-				logger.Info().
-					Str("message_id", sendSMSPayload.MessageId).
-					Msg("Successfully processed SMS request")
-			}
-		default:
-			logger.Warn().
-				Str("message_type", payload.Type).
-				Msg("Received unknown message type")
-		}
+// finishDeadLettered dead-letters a message that can never be processed and reports whether it is done with.
+func (c *KafkaDaoImpl) finishDeadLettered(msg *kafka.Message, attempt int, cause error, abort <-chan struct{}) bool {
+	err := c.deadLetter(msg, attempt, cause, abort)
+	if err != nil {
+		return false
+	}
+	metrics.IncKafkaConsumed(*msg.TopicPartition.Topic, metrics.KAFKA_RESULT_DEAD_LETTERED)
+	return true
+}
+
+// recordConsumerLag updates the lag of the message's partition from the consumer's cached high watermark.
+func recordConsumerLag(consumer *kafka.Consumer, msg *kafka.Message) {
+	_, high, err := consumer.GetWatermarkOffsets(*msg.TopicPartition.Topic, msg.TopicPartition.Partition)
+	if err != nil || high < 0 {
+		return
 	}
+	metrics.SetKafkaConsumerLag(*msg.TopicPartition.Topic, msg.TopicPartition.Partition, max(high-int64(msg.TopicPartition.Offset)-1, 0))
 }
@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/internal/metrics"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"github.com/padam-meesho/NotificationService/internal/utils"
+)
+
+// headers carrying the retry metadata of a message between the main, retry and dead-letter topics.
+const (
+	HEADER_ATTEMPT        = "x-attempt"        // attempt number the message is on, the first read off the main topic is 1
+	HEADER_RETRY_AT       = "x-retry-at"       // unix millis before which a retry tier must not process the message
+	HEADER_LAST_ERROR     = "x-last-error"     // error of the previous attempt
+	HEADER_ORIGINAL_TOPIC = "x-original-topic" // topic the message was first produced to
+)
+
+// how long a worker waits before producing a copy to a retry or dead-letter topic again after the broker did not
+// take it, doubled on every further failure up to MAX_MOVE_BACKOFF.
+const (
+	MOVE_BACKOFF     = time.Second
+	MAX_MOVE_BACKOFF = 30 * time.Second
+)
+
+// retry moves a failed message to the retry tier for its attempt.
+// It returns false when the message has used up its attempts and was dead-lettered instead,
+// and an error when the message could not be moved to either topic before abort was closed or the consumers stopped.
+func (c *KafkaDaoImpl) retry(msg *kafka.Message, attempt int, cause error, abort <-chan struct{}) (bool, error) {
+	tier, ok := retryTier(c.retryTiers, c.maxAttempts, attempt)
+	if !ok {
+		return false, c.deadLetter(msg, attempt, cause, abort)
+	}
+	logger := utils.KafkaLogger("retry", tier.Topic)
+
+	headers := withHeader(msg.Headers, HEADER_ATTEMPT, strconv.Itoa(attempt+1))
+	headers = withHeader(headers, HEADER_RETRY_AT, strconv.FormatInt(time.Now().Add(tier.Delay).UnixMilli(), 10))
+	headers = withHeader(headers, HEADER_LAST_ERROR, cause.Error())
+	headers = withHeader(headers, HEADER_ORIGINAL_TOPIC, originalTopic(msg))
+
+	err := c.produceCopy(tier.Topic, msg.Key, msg.Value, headers, abort)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("attempt", attempt).
+			Msg("Failed to move message to retry topic")
+		return true, err
+	}
+
+	logger.Info().
+		Int("next_attempt", attempt+1).
+		Dur("delay", tier.Delay).
+		Msg("Message scheduled for retry")
+	return true, nil
+}
+
+// deadLetter parks a message on the dead-letter topic with the reason it was given up on.
+// Without a dead-letter topic the message is dropped, that is not an error.
+func (c *KafkaDaoImpl) deadLetter(msg *kafka.Message, attempt int, cause error, abort <-chan struct{}) error {
+	logger := utils.KafkaLogger("dead_letter", c.dlqTopic)
+
+	if c.dlqTopic == "" {
+		logger.Error().
+			Err(cause).
+			Int("attempt", attempt).
+			Str("raw_message", string(msg.Value)).
+			Msg("No dead-letter topic configured, dropping message")
+		return nil
+	}
+
+	headers := withHeader(msg.Headers, HEADER_ATTEMPT, strconv.Itoa(attempt))
+	headers = withHeader(headers, HEADER_LAST_ERROR, cause.Error())
+	headers = withHeader(headers, HEADER_ORIGINAL_TOPIC, originalTopic(msg))
+
+	err := c.produceCopy(c.dlqTopic, msg.Key, msg.Value, headers, abort)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Int("attempt", attempt).
+			Str("raw_message", string(msg.Value)).
+			Msg("Failed to move message to dead-letter topic")
+		return err
+	}
+
+	logger.Warn().
+		Err(cause).
+		Int("attempt", attempt).
+		Msg("Message moved to dead-letter topic")
+	return nil
+}
+
+// produceCopy produces a copy of a consumed message until the broker stores it. Only the produce is repeated, the
+// message was already handled, so a broker that is down for a while never has a request sent twice. It gives up
+// once abort is closed, e.g. because the message's partition was revoked, or the consumers stop.
+func (c *KafkaDaoImpl) produceCopy(topic string, key []byte, value []byte, headers []kafka.Header, abort <-chan struct{}) error {
+	logger := utils.KafkaLogger("produce", topic)
+
+	backoff := MOVE_BACKOFF
+	for {
+		err := c.produceRaw(topic, key, value, headers)
+		if err == nil {
+			metrics.IncKafkaProduced(topic, metrics.KAFKA_RESULT_OK)
+			return nil
+		}
+		metrics.IncKafkaProduced(topic, metrics.KAFKA_RESULT_ERROR)
+		logger.Warn().
+			Err(err).
+			Dur("backoff", backoff).
+			Msg("Failed to produce message copy, producing it again")
+		select {
+		case <-time.After(backoff):
+		case <-c.stop:
+			return err
+		case <-abort:
+			return err
+		}
+		backoff = min(backoff*2, MAX_MOVE_BACKOFF)
+	}
+}
+
+// produceRaw produces a copy of a consumed message, under the same key, and waits for the broker to store it:
+// the consumer only commits the original's offset once its copy is safe on the retry or dead-letter topic.
+func (c *KafkaDaoImpl) produceRaw(topic string, key []byte, value []byte, headers []kafka.Header) error {
+	deliveryChan := make(chan kafka.Event, 1)
+	err := c.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:     key,
+		Value:   value,
+		Headers: headers,
+	}, deliveryChan)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(c.deliveryTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case event := <-deliveryChan:
+			msg, ok := event.(*kafka.Message)
+			if !ok {
+				continue
+			}
+			return msg.TopicPartition.Error
+		case <-timeout.C:
+			return ErrDeliveryTimeout
+		}
+	}
+}
+
+// retryTier picks the tier a message that failed the given attempt is retried on, the last tier once the earlier
+// ones are used up. ok is false when the message has no attempts left and goes to the dead-letter topic.
+func retryTier(tiers []models.KafkaRetryTier, maxAttempts int, attempt int) (models.KafkaRetryTier, bool) {
+	if attempt >= maxAttempts || len(tiers) == 0 {
+		return models.KafkaRetryTier{}, false
+	}
+	return tiers[min(max(attempt, 1)-1, len(tiers)-1)], true
+}
+
+func headerValue(headers []kafka.Header, key string) (string, bool) {
+	for _, header := range headers {
+		if header.Key == key {
+			return string(header.Value), true
+		}
+	}
+	return "", false
+}
+
+// withHeader returns a copy of headers with key set to value, replacing any previous value.
+func withHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	updated := make([]kafka.Header, 0, len(headers)+1)
+	for _, header := range headers {
+		if header.Key != key {
+			updated = append(updated, header)
+		}
+	}
+	return append(updated, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func attemptOf(msg *kafka.Message) int {
+	value, ok := headerValue(msg.Headers, HEADER_ATTEMPT)
+	if !ok {
+		return 1
+	}
+	attempt, err := strconv.Atoi(value)
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
+
+func retryAt(msg *kafka.Message) time.Time {
+	value, ok := headerValue(msg.Headers, HEADER_RETRY_AT)
+	if !ok {
+		return time.Time{}
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+func originalTopic(msg *kafka.Message) string {
+	if topic, ok := headerValue(msg.Headers, HEADER_ORIGINAL_TOPIC); ok {
+		return topic
+	}
+	return *msg.TopicPartition.Topic
+}
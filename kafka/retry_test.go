@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/internal/models"
+)
+
+func messageWithHeaders(topic string, headers ...kafka.Header) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Headers:        headers,
+	}
+}
+
+func header(key, value string) kafka.Header {
+	return kafka.Header{Key: key, Value: []byte(value)}
+}
+
+func TestAttemptOf(t *testing.T) {
+	if got := attemptOf(messageWithHeaders(KAFKA_TOPIC_NAME)); got != 1 {
+		t.Errorf("attemptOf() of a message off the main topic = %d, want 1", got)
+	}
+	if got := attemptOf(messageWithHeaders("retry", header(HEADER_ATTEMPT, "3"))); got != 3 {
+		t.Errorf("attemptOf() = %d, want 3", got)
+	}
+	// a header that makes no sense must not skip the message past its attempts, nor loop it forever.
+	for _, value := range []string{"", "three", "0", "-2"} {
+		if got := attemptOf(messageWithHeaders("retry", header(HEADER_ATTEMPT, value))); got != 1 {
+			t.Errorf("attemptOf() with %s %q = %d, want 1", HEADER_ATTEMPT, value, got)
+		}
+	}
+}
+
+func TestRetryAt(t *testing.T) {
+	due := time.Now().Add(10 * time.Minute).Truncate(time.Millisecond)
+	msg := messageWithHeaders("retry", header(HEADER_RETRY_AT, strconv.FormatInt(due.UnixMilli(), 10)))
+	if got := retryAt(msg); !got.Equal(due) {
+		t.Errorf("retryAt() = %v, want %v", got, due)
+	}
+
+	// without a valid due time the message is processed right away.
+	for _, msg := range []*kafka.Message{
+		messageWithHeaders("retry"),
+		messageWithHeaders("retry", header(HEADER_RETRY_AT, "soon")),
+	} {
+		if got := retryAt(msg); !got.IsZero() {
+			t.Errorf("retryAt() = %v, want the zero time", got)
+		}
+	}
+}
+
+func TestOriginalTopic(t *testing.T) {
+	if got := originalTopic(messageWithHeaders(KAFKA_TOPIC_NAME)); got != KAFKA_TOPIC_NAME {
+		t.Errorf("originalTopic() of a first attempt = %q, want the topic it was read from", got)
+	}
+	msg := messageWithHeaders("notification.send_sms.retry.10m", header(HEADER_ORIGINAL_TOPIC, KAFKA_TOPIC_NAME))
+	if got := originalTopic(msg); got != KAFKA_TOPIC_NAME {
+		t.Errorf("originalTopic() of a retry = %q, want %q", got, KAFKA_TOPIC_NAME)
+	}
+}
+
+func TestWithHeaderReplacesValue(t *testing.T) {
+	headers := []kafka.Header{header("traceparent", "00-abc-def-01"), header(HEADER_ATTEMPT, "1")}
+	updated := withHeader(headers, HEADER_ATTEMPT, "2")
+
+	if len(updated) != 2 {
+		t.Fatalf("withHeader() = %v, want the attempt header replaced, not added", updated)
+	}
+	if value, _ := headerValue(updated, HEADER_ATTEMPT); value != "2" {
+		t.Errorf("%s = %q, want 2", HEADER_ATTEMPT, value)
+	}
+	if value, _ := headerValue(updated, "traceparent"); value != "00-abc-def-01" {
+		t.Errorf("traceparent = %q, want it kept", value)
+	}
+	if value, _ := headerValue(headers, HEADER_ATTEMPT); value != "1" {
+		t.Errorf("withHeader() changed the original headers, %s = %q", HEADER_ATTEMPT, value)
+	}
+}
+
+func TestRetryTier(t *testing.T) {
+	tiers := []models.KafkaRetryTier{
+		{Topic: "notification.send_sms.retry.1m", Delay: time.Minute},
+		{Topic: "notification.send_sms.retry.10m", Delay: 10 * time.Minute},
+	}
+
+	// attempts 1 and 2 use their own tier, 3 and 4 keep using the last one, 5 is the last attempt.
+	wantTopics := map[int]string{
+		1: "notification.send_sms.retry.1m",
+		2: "notification.send_sms.retry.10m",
+		3: "notification.send_sms.retry.10m",
+		4: "notification.send_sms.retry.10m",
+	}
+	for attempt := 1; attempt <= 5; attempt++ {
+		tier, ok := retryTier(tiers, 5, attempt)
+		want, retried := wantTopics[attempt]
+		if ok != retried || tier.Topic != want {
+			t.Errorf("retryTier(attempt %d) = %q, %v, want %q, %v", attempt, tier.Topic, ok, want, retried)
+		}
+	}
+
+	if _, ok := retryTier(nil, 5, 1); ok {
+		t.Errorf("retryTier() without tiers retried the message, want it dead-lettered")
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/padam-meesho/NotificationService/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the trace of a request travels between the producer and the consumer in the message headers, as W3C
+// traceparent/tracestate. Retry and dead-letter copies keep the headers, so every attempt joins the same trace.
+
+const TRACER_NAME = "github.com/padam-meesho/NotificationService/kafka"
+
+// headerCarrier lets the otel propagator read and write kafka message headers.
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (carrier headerCarrier) Get(key string) string {
+	value, _ := headerValue(*carrier.headers, key)
+	return value
+}
+
+func (carrier headerCarrier) Set(key, value string) {
+	*carrier.headers = withHeader(*carrier.headers, key, value)
+}
+
+func (carrier headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*carrier.headers))
+	for _, header := range *carrier.headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// startProduceSpan opens the producer span of a publish to topic and returns the headers carrying it.
+func startProduceSpan(ctx context.Context, topic string, count int) (trace.Span, []kafka.Header) {
+	ctx, span := otel.Tracer(TRACER_NAME).Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.Int("messaging.batch.message_count", count),
+		))
+	return span, traceHeaders(ctx)
+}
+
+// traceHeaders returns the message headers carrying the trace of ctx.
+func traceHeaders(ctx context.Context) []kafka.Header {
+	var headers []kafka.Header
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &headers})
+	return headers
+}
+
+// payloadTraceHeaders returns the headers of a payload produced under ctx, or under the trace the payload
+// brings along, e.g. the api call an outbox entry was written by.
+func payloadTraceHeaders(ctx context.Context, payload models.KafkaPayload, headers []kafka.Header) []kafka.Header {
+	if len(payload.TraceContext) == 0 {
+		return headers
+	}
+	return traceHeaders(otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(payload.TraceContext)))
+}
+
+// startConsumeSpan rebuilds the producer's trace from the message headers and opens the consumer span
+// of processing msg under it.
+func startConsumeSpan(msg *kafka.Message) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{headers: &msg.Headers})
+	return otel.Tracer(TRACER_NAME).Start(ctx, *msg.TopicPartition.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", *msg.TopicPartition.Topic),
+			attribute.Int("messaging.kafka.destination.partition", int(msg.TopicPartition.Partition)),
+			attribute.Int64("messaging.kafka.message.offset", int64(msg.TopicPartition.Offset)),
+			attribute.Int("messaging.kafka.attempt", attemptOf(msg)),
+		))
+}